@@ -0,0 +1,92 @@
+package devslog
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// errClosed is returned by Handle when an asynchronous handler has been
+// closed.
+var errClosed = errors.New("devslog: handler is closed")
+
+// asyncWriter owns the writing of the records of a handler whose
+// Options.AsyncBuffer is set. It's shared by the handlers derived from it.
+type asyncWriter struct {
+	// mu guards closed. Handle holds it for reading while queuing a record.
+	mu      sync.RWMutex
+	closed  bool
+	once    sync.Once
+	records chan asyncRecord
+	done    chan struct{}
+
+	// errs are the errors of the writes. They're only accessed by the
+	// goroutine until done is closed.
+	errs []error
+}
+
+// asyncRecord is a formatted record waiting to be written, or a request to
+// signal that every record before it has been written, if flushed is not nil.
+type asyncRecord struct {
+	h       *Handler
+	level   slog.Level
+	out     []byte
+	flushed chan struct{}
+}
+
+func newAsyncWriter(size int) *asyncWriter {
+	a := &asyncWriter{
+		records: make(chan asyncRecord, size),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// run writes the queued records until the queue is closed.
+func (a *asyncWriter) run() {
+	defer close(a.done)
+	for rec := range a.records {
+		if rec.flushed != nil {
+			close(rec.flushed)
+			continue
+		}
+		if err := rec.h.write(rec.level, rec.out); err != nil {
+			a.errs = append(a.errs, err)
+		}
+	}
+}
+
+// send queues rec. It blocks while the queue is full.
+func (a *asyncWriter) send(rec asyncRecord) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return errClosed
+	}
+	a.records <- rec
+	return nil
+}
+
+// wait blocks until the records queued before the call have been written.
+func (a *asyncWriter) wait() {
+	flushed := make(chan struct{})
+	if a.send(asyncRecord{flushed: flushed}) != nil {
+		return
+	}
+	<-flushed
+}
+
+// close stops accepting records and waits for the queued ones to be written.
+// It returns the errors of the writes.
+func (a *asyncWriter) close() error {
+	a.once.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		close(a.records)
+		a.mu.Unlock()
+	})
+	<-a.done
+	return errors.Join(a.errs...)
+}
@@ -0,0 +1,41 @@
+package devslog
+
+import (
+	"strings"
+	"time"
+)
+
+// durationBarWidth is the number of cells of a duration bar.
+const durationBarWidth = 10
+
+// barEighths are the blocks used for the partially filled cell of a bar, from
+// 1/8 to 7/8 of a cell.
+var barEighths = []string{"▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// durationBar renders d as a bar whose length is proportional to d relative to
+// the DurationBarMax option. Durations of at least the maximum fill the bar.
+// It returns an empty string when bars are disabled, including when colors
+// are.
+func (h *Handler) durationBar(d time.Duration) string {
+	maxDur := h.opts.DurationBarMax
+	if maxDur <= 0 || h.depth == ColorDepthNone {
+		return ""
+	}
+
+	eighths := durationBarWidth * 8
+	if d < maxDur {
+		eighths = int(int64(max(d, 0)) * int64(durationBarWidth*8) / int64(maxDur))
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat("█", eighths/8))
+	cells := eighths / 8
+	if rem := eighths % 8; rem > 0 {
+		b.WriteString(barEighths[rem-1])
+		cells++
+	}
+	if cells < durationBarWidth {
+		b.WriteString(h.gray(strings.Repeat("·", durationBarWidth-cells)))
+	}
+	return b.String()
+}
@@ -0,0 +1,157 @@
+package devslog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// errBatchClosed is returned by Batch.Handle after the batch was closed.
+var errBatchClosed = errors.New("devslog: batch is closed")
+
+// batchRuleWidth is the number of columns of the lines around a batch.
+const batchRuleWidth = 40
+
+// A Batch is a [slog.Handler] that collects records and writes them together
+// when it's closed, so that the records of other goroutines don't come in
+// between. It's created by [Handler.Batch]. The records are formatted the same
+// way as by the handler, and routed the same way; each writer receives the
+// records meant for it in a single write, except for writers that want to know
+// the level of each record, which receive them one by one.
+//
+// A Batch is safe for concurrent use. Batches that are still open when the
+// handler is closed are written by [Handler.Close].
+type Batch struct {
+	h *Handler
+	b *batch
+}
+
+// batch is the state of a Batch, shared with the batches derived from it.
+type batch struct {
+	title string
+
+	mu      sync.Mutex
+	records []batchRecord
+	closed  bool
+}
+
+// batchRecord is a formatted record of a batch. h is the handler that formatted
+// it, which determines its destinations.
+type batchRecord struct {
+	h     *Handler
+	level slog.Level
+	out   []byte
+}
+
+// Batch returns a Batch that writes its records together when it's closed. If
+// title is not empty, the records are written between a line with the title
+// and a closing line.
+func (h *Handler) Batch(title string) *Batch {
+	b := &batch{title: title}
+
+	h.mu.Lock()
+	h.state.batches = append(h.state.batches, b)
+	h.mu.Unlock()
+
+	return &Batch{h: h, b: b}
+}
+
+// Enabled reports whether the handler of the batch handles records at level.
+func (b *Batch) Enabled(ctx context.Context, level slog.Level) bool {
+	return b.h.Enabled(ctx, level)
+}
+
+// Handle formats r and keeps it until the batch is closed.
+func (b *Batch) Handle(ctx context.Context, r slog.Record) error {
+	out := b.h.format(ctx, r)
+
+	b.b.mu.Lock()
+	defer b.b.mu.Unlock()
+
+	if b.b.closed {
+		return errBatchClosed
+	}
+	b.b.records = append(b.b.records, batchRecord{h: b.h, level: r.Level, out: out})
+	return nil
+}
+
+// WithAttrs returns a Batch that adds attrs to the records it collects into
+// the same batch.
+func (b *Batch) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Batch{h: b.h.WithAttrs(attrs).(*Handler), b: b.b}
+}
+
+// WithGroup returns a Batch that opens a group in the records it collects into
+// the same batch.
+func (b *Batch) WithGroup(name string) slog.Handler {
+	return &Batch{h: b.h.WithGroup(name).(*Handler), b: b.b}
+}
+
+// Close writes the records of the batch. Closing a batch more than once does
+// nothing.
+func (b *Batch) Close() error {
+	b.h.mu.Lock()
+	defer b.h.mu.Unlock()
+
+	return b.h.writeBatch(b.b)
+}
+
+// writeBatch writes the records of b, unless it was already written, and
+// forgets it. The caller must hold the mutex.
+func (h *Handler) writeBatch(b *batch) error {
+	h.state.batches = slices.DeleteFunc(h.state.batches, func(other *batch) bool { return other == b })
+
+	b.mu.Lock()
+	records := b.records
+	closed := b.closed
+	b.records, b.closed = nil, true
+	b.mu.Unlock()
+
+	if closed || len(records) == 0 {
+		return nil
+	}
+
+	// Gather the records of each writer in order.
+	type block struct {
+		w   io.Writer
+		out []byte
+	}
+	var blocks []*block
+	var errs []error
+	for _, rec := range records {
+		for _, w := range rec.h.destinations(rec.level) {
+			if lw, ok := w.(levelWriter); ok {
+				_, err := lw.WriteLevel(rec.level, rec.out)
+				errs = append(errs, err)
+				continue
+			}
+			i := slices.IndexFunc(blocks, func(bl *block) bool { return sameWriter(bl.w, w) })
+			if i < 0 {
+				i = len(blocks)
+				blocks = append(blocks, &block{w: w})
+			}
+			blocks[i].out = append(blocks[i].out, rec.out...)
+		}
+	}
+
+	preamble := h.preamble()
+	for _, bl := range blocks {
+		out := bl.out
+		if b.title != "" {
+			out = append([]byte(h.batchHeader(b.title)), out...)
+			out = append(out, h.gray(h.rule(batchRuleWidth))+"\n"...)
+		}
+		_, err := bl.w.Write(append([]byte(preamble), out...))
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// batchHeader returns the line written before the records of a batch.
+func (h *Handler) batchHeader(title string) string {
+	rule := h.rule(max(batchRuleWidth-visibleWidth(title)-4, 2))
+	return h.gray(h.rule(2)+" "+title+" "+rule) + "\n"
+}
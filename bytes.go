@@ -0,0 +1,72 @@
+package devslog
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// defaultHexDumpMinLen is the value of Options.HexDumpMinLen when it's not set.
+const defaultHexDumpMinLen = 16
+
+// defaultHexDumpMaxLen is the value of Options.HexDumpMaxLen when it's not set.
+const defaultHexDumpMaxLen = 512
+
+// formatBytes renders b on a single line, as a hexadecimal or, with the
+// Base64Bytes option, a base64 string.
+func (h *Handler) formatBytes(b []byte) string {
+	if len(b) == 0 {
+		return "(0 bytes)"
+	}
+	if h.opts.Base64Bytes {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+// hexDump reports whether b is long enough to be rendered as a hex dump.
+func (h *Handler) hexDump(b []byte) bool {
+	minLen := h.opts.HexDumpMinLen
+	if minLen == 0 {
+		minLen = defaultHexDumpMinLen
+	}
+	return len(b) > 0 && len(b) >= minLen
+}
+
+// appendHexDump writes the line of an attribute whose value is b, followed by
+// the hex dump of b, in the format of [hex.Dump], on continuation lines. Only
+// the first HexDumpMaxLen bytes are dumped, followed by the number of the
+// others.
+func (h *Handler) appendHexDump(buf *bytes.Buffer, key string, b []byte, indentLevel int, groups []string, align int) {
+	h.appendKeyVal(buf, key, h.gray("("+strconv.Itoa(len(b))+" bytes)"), indentLevel, groups, align)
+
+	maxLen := h.opts.HexDumpMaxLen
+	if maxLen == 0 {
+		maxLen = defaultHexDumpMaxLen
+	}
+	var rest int
+	if maxLen > 0 && len(b) > maxLen {
+		b, rest = b[:maxLen], len(b)-maxLen
+	}
+	lines := strings.Split(strings.TrimSuffix(hex.Dump(b), "\n"), "\n")
+	if rest > 0 {
+		lines = append(lines, h.gray("… ("+strconv.Itoa(rest)+" more bytes)"))
+	}
+	h.appendBlock(buf, lines, indentLevel)
+}
+
+// appendBlock writes the continuation lines of an attribute's value, indented
+// like the attributes of a group would be.
+func (h *Handler) appendBlock(buf *bytes.Buffer, lines []string, indentLevel int) {
+	for _, line := range lines {
+		if h.opts.TreeConnectors {
+			h.appendIndent(buf, indentLevel+1)
+			_, _ = buf.WriteString(line + "\n")
+			continue
+		}
+		h.appendIndent(buf, indentLevel)
+		_, _ = buf.WriteString(h.opts.Indent + " " + line + "\n")
+	}
+}
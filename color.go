@@ -1,17 +1,66 @@
 package devslog
 
-import "log/slog"
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+const resetColour = "\033[0m"
+
+// A Color is the parameter of an ANSI SGR escape sequence that sets the
+// foreground color of the terminal, such as "31" for red. Other SGR parameters
+// may be combined with it, as in "1;31" for bold red. Colors with more than
+// the basic palette, created with [RGB] or [Color256], are converted to the
+// closest color that the terminal supports.
+type Color string
+
+// The basic terminal colors.
+const (
+	Black         Color = "30"
+	Red           Color = "31"
+	Green         Color = "32"
+	Yellow        Color = "33"
+	Blue          Color = "34"
+	Magenta       Color = "35"
+	Cyan          Color = "36"
+	White         Color = "37"
+	Gray          Color = "90"
+	BrightRed     Color = "91"
+	BrightGreen   Color = "92"
+	BrightYellow  Color = "93"
+	BrightBlue    Color = "94"
+	BrightMagenta Color = "95"
+	BrightCyan    Color = "96"
+	BrightWhite   Color = "97"
+)
 
+// Text attributes, which can be used like colors.
 const (
-	resetColour  = "\033[0m"
-	colourRed    = "\033[31m"
-	colourYellow = "\033[33m"
-	colourWhite  = "\033[37m"
-	colorGray    = "\033[90m"
+	Bold      Color = "1"
+	Dim       Color = "2"
+	Italic    Color = "3"
+	Underline Color = "4"
 )
 
-func levelColour(l slog.Level) string {
+// The colors used by default. They use richer hues on terminals that support
+// them, and the basic palette otherwise.
+var (
+	colourRed    = Adaptive(RGB(255, 95, 95), Color256(203), Red)
+	colourFatal  = Adaptive("1;"+RGB(255, 95, 95), "1;"+Color256(203), "1;"+Red)
+	colourGreen  = Adaptive(RGB(135, 215, 135), Color256(114), Green)
+	colourYellow = Adaptive(RGB(255, 215, 95), Color256(221), Yellow)
+	colourWhite  = White
+	colorGray    = Adaptive(Color256(245), Gray)
+)
+
+func levelColour(l slog.Level) Color {
 	switch l {
+	case LevelFatal:
+		return colourFatal
+	case LevelTrace:
+		return Dim
 	case slog.LevelError:
 		return colourRed
 	case slog.LevelWarn:
@@ -25,10 +74,163 @@ func levelColour(l slog.Level) string {
 	}
 }
 
-func text(color string, text string) string {
-	return color + text + resetColour
+// defaultKindColors are the colors of values with the ColorValues option.
+var defaultKindColors = map[slog.Kind]Color{
+	slog.KindString:   Green,
+	slog.KindInt64:    Cyan,
+	slog.KindUint64:   Cyan,
+	slog.KindFloat64:  Cyan,
+	slog.KindBool:     Magenta,
+	slog.KindTime:     Blue,
+	slog.KindDuration: Blue,
+}
+
+// valueText colors s, the rendered form of v, by the kind of v when the
+// ColorValues option is set. Errors, and the values of a LogValue method that
+// panicked, are always colored like errors. The ValueMarkers option takes
+// precedence over ColorValues for booleans and nil, and URLLinks for URLs.
+func (h *Handler) valueText(v slog.Value, s string) string {
+	if _, ok := errorValue(v); ok {
+		return h.text(colourRed, s)
+	}
+	if v.Kind() == slog.KindAny {
+		switch x := v.Any().(type) {
+		case resolvePanic:
+			return h.text(colourRed, s)
+		case untruncated:
+			// Color it like any other string.
+			v = slog.StringValue(string(x))
+		case formatted:
+			return h.text(x.color, s)
+		}
+	}
+	if link, ok := h.linkURL(v, s); ok {
+		return link
+	}
+	if h.opts.ValueMarkers {
+		switch {
+		case v.Kind() == slog.KindBool && v.Bool():
+			return h.text(colourGreen, s)
+		case v.Kind() == slog.KindBool:
+			return h.text(colourRed, s)
+		case isNil(v):
+			return h.text(Italic, h.gray(s))
+		}
+	}
+	if !h.opts.ColorValues {
+		return s
+	}
+	return h.text(h.kindColor(v.Kind()), s)
+}
+
+// kindColor returns the color of the values of kind with the ColorValues
+// option.
+func (h *Handler) kindColor(kind slog.Kind) Color {
+	if c, ok := h.opts.KindColors[kind]; ok {
+		return c
+	}
+	return defaultKindColors[kind]
+}
+
+// isNil reports whether v holds nil, or a nil pointer.
+func isNil(v slog.Value) bool {
+	if v.Kind() != slog.KindAny {
+		return false
+	}
+	a := v.Any()
+	if a == nil {
+		return true
+	}
+	rv := reflect.ValueOf(a)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// text wraps text in the escape sequences for color, unless colors are
+// disabled or color is empty.
+func (h *Handler) text(color Color, text string) string {
+	code := color.seq(h.depth)
+	if code == "" {
+		return text
+	}
+	return code + text + resetColour
+}
+
+func (h *Handler) gray(text string) string {
+	return h.styled(h.graySeq, text)
+}
+
+// appendGray writes text to buf in gray, like gray, without allocating.
+func (h *Handler) appendGray(buf *bytes.Buffer, text string) {
+	h.appendStyled(buf, h.graySeq, text)
+}
+
+// styled wraps text in seq, an escape sequence returned by Color.seq.
+func (h *Handler) styled(seq, text string) string {
+	if seq == "" {
+		return text
+	}
+	return seq + text + resetColour
 }
 
-func gray(text string) string {
-	return colorGray + text + resetColour
+// appendStyled writes text to buf, wrapped in seq like styled, without
+// allocating.
+func (h *Handler) appendStyled(buf *bytes.Buffer, seq, text string) {
+	if seq == "" {
+		_, _ = buf.WriteString(text)
+		return
+	}
+	_, _ = buf.WriteString(seq)
+	_, _ = buf.WriteString(text)
+	_, _ = buf.WriteString(resetColour)
+}
+
+// stripANSI removes ANSI escape sequences from s. It understands CSI sequences,
+// such as the colors used by this package, and OSC sequences, which are
+// terminated by either BEL or ST.
+func stripANSI(s string) string {
+	if !strings.Contains(s, "\033") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\033' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i = escapeEnd(s, i)
+	}
+	return b.String()
+}
+
+// escapeEnd returns the index of the last byte of the escape sequence that
+// starts at s[i].
+func escapeEnd(s string, i int) int {
+	switch s[i+1] {
+	case '[':
+		// CSI: parameter and intermediate bytes, then a final byte in the
+		// range 0x40-0x7E.
+		j := i + 2
+		for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+			j++
+		}
+		return j
+	case ']':
+		// OSC: terminated by BEL or by ESC \.
+		j := i + 2
+		for j < len(s) {
+			if s[j] == '\a' {
+				break
+			}
+			if s[j] == '\033' && j+1 < len(s) && s[j+1] == '\\' {
+				j++
+				break
+			}
+			j++
+		}
+		return j
+	default:
+		return i + 1
+	}
 }
@@ -0,0 +1,114 @@
+package devslog
+
+import (
+	"bytes"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// compact reports whether r is rendered on a single line, because of the
+// Compact option or because it has no more attributes than InlineMaxAttrs.
+func (h *Handler) compact(r slog.Record) bool {
+	if h.opts.Compact {
+		return true
+	}
+	if h.opts.InlineMaxAttrs <= 0 {
+		return false
+	}
+	var n int
+	for _, lvl := range h.attrLevels(r) {
+		n += countAttrs(lvl.attrs)
+	}
+	return n <= h.opts.InlineMaxAttrs
+}
+
+// appendCompact writes the attributes of the handler and the record on the
+// same line as the message, as space-separated key=value pairs. Group names are
+// joined to the keys of their attributes with the GroupSeparator option.
+func (h *Handler) appendCompact(buf *bytes.Buffer, r slog.Record) {
+	var groups []string
+	for _, lvl := range h.attrLevels(r) {
+		if lvl.group != "" {
+			groups = append(groups, lvl.group)
+		}
+		for _, a := range lvl.attrs {
+			h.appendCompactAttr(buf, a, groups)
+		}
+	}
+}
+
+func (h *Handler) appendCompactAttr(buf *bytes.Buffer, a slog.Attr, groups []string) {
+	a = h.replaceAttr(groups, a)
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if h.beyondMaxDepth(groups, a) {
+		a = slog.String(a.Key, depthSummary(a.Value.Group()))
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := h.groupAttrs(a.Value.Group())
+		if len(attrs) == 0 {
+			return
+		}
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, ga := range attrs {
+			h.appendCompactAttr(buf, ga, groups)
+		}
+		return
+	}
+
+	key := h.displayKey(a.Key)
+	if h.opts.JSONPathKeys {
+		key = jsonPath(h.displayKeys(groups), key)
+	} else {
+		key = h.flatKey(groups, key)
+	}
+
+	start := buf.Len()
+	defer func() {
+		if p := recover(); p != nil {
+			buf.Truncate(start)
+			_, _ = buf.WriteString(" " + h.styled(h.keySeq, key) + "=" + h.text(colourRed, strconv.Quote(formatPanic(p))))
+		}
+	}()
+	_, _ = buf.WriteString(" " + h.styled(h.attrKeySeq(a.Value), key) + "=" + h.valueText(a.Value, quoteIfNeeded(h.formatValue(a.Key, a.Value))))
+}
+
+// quoteIfNeeded quotes s when it would otherwise be ambiguous on a compact
+// line: when it's empty, or contains spaces, quotes, '=' or unprintable runes.
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+				return strconv.Quote(s)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+		i += size
+	}
+	return s
+}
+
+// flatKey joins the names of groups and key with the GroupSeparator option.
+func (h *Handler) flatKey(groups []string, key string) string {
+	sep := h.opts.GroupSeparator
+	if sep == "" {
+		sep = "."
+	}
+	return strings.Join(append(h.displayKeys(groups)[:len(groups):len(groups)], key), sep)
+}
@@ -0,0 +1,218 @@
+package devslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// config is the content of the files read by LoadConfig.
+type config struct {
+	Level        string          `json:"level"`
+	Color        string          `json:"color"`
+	TimeFormat   string          `json:"time_format"`
+	AddSource    bool            `json:"add_source"`
+	Theme        json.RawMessage `json:"theme"`
+	RedactKeys   []string        `json:"redact_keys"`
+	RedactMode   string          `json:"redact_mode"`
+	MaskPatterns []string        `json:"mask_patterns"`
+}
+
+// themeConfig is a theme written as the colors of its elements.
+type themeConfig struct {
+	Levels  map[string]string `json:"levels"`
+	Key     string            `json:"key"`
+	Group   string            `json:"group"`
+	Time    string            `json:"time"`
+	Message string            `json:"message"`
+	Source  string            `json:"source"`
+	Muted   string            `json:"muted"`
+}
+
+// LoadConfig reads the options of a handler from the JSON file at path, so
+// that they can be shared, for instance as a .devslog.json file in each
+// repository of a team. Every field is optional:
+//
+//	{
+//		"level": "info,db=debug",
+//		"color": "auto",
+//		"time_format": "15:04:05.000",
+//		"add_source": true,
+//		"theme": {"key": "cyan", "levels": {"warn": "#ffaf00"}},
+//		"redact_keys": ["*token*", "authorization"],
+//		"redact_mode": "hash",
+//		"mask_patterns": ["\\d{4}-\\d{4}-\\d{4}-\\d{4}"]
+//	}
+//
+// level holds directives in the syntax of [ParseLevelDirectives]. color is
+// "auto", "always", "never", "true" or "false". theme is "dark", "light", or
+// the colors of the fields of [Theme]. Colors are the names of the basic
+// colors and text attributes, such as "red", "bright_blue" or "bold", numbers
+// of the xterm 256-color palette, or hexadecimal colors, such as "#ff8700".
+// redact_mode is "hide" or "hash". Unknown fields are reported as errors, to
+// catch typos.
+func LoadConfig(path string) (*Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("devslog: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var c config
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("devslog: %s: %w", path, err)
+	}
+	opts, err := c.options()
+	if err != nil {
+		return nil, fmt.Errorf("devslog: %s: %w", path, err)
+	}
+	return opts, nil
+}
+
+// options returns the options that c sets.
+func (c config) options() (*Options, error) {
+	opts := &Options{
+		TimeFormat: c.TimeFormat,
+		RedactKeys: c.RedactKeys,
+	}
+	opts.AddSource = c.AddSource
+
+	if c.Level != "" {
+		level, groups, err := parseLevelDirectives(c.Level)
+		if err != nil {
+			return nil, err
+		}
+		if level != nil {
+			opts.Level = newLevelVar(level.Level())
+		}
+		mergeGroupLevels(opts, groups)
+	}
+	if c.Color != "" && !setColor(opts, c.Color) {
+		return nil, fmt.Errorf("color %q: want auto, always, never, true or false", c.Color)
+	}
+	theme, err := parseThemeConfig(c.Theme)
+	if err != nil {
+		return nil, err
+	}
+	opts.Theme = theme
+
+	switch c.RedactMode {
+	case "", "hide":
+	case "hash":
+		opts.RedactMode = RedactHash
+	default:
+		return nil, fmt.Errorf("redact_mode %q: want hide or hash", c.RedactMode)
+	}
+	for _, pattern := range c.MaskPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("mask_patterns: %w", err)
+		}
+		opts.MaskPatterns = append(opts.MaskPatterns, MaskPattern{Pattern: re})
+	}
+	return opts, nil
+}
+
+// parseThemeConfig returns the theme of the theme field of a config file.
+func parseThemeConfig(raw json.RawMessage) (Theme, error) {
+	if len(raw) == 0 {
+		return Theme{}, nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		switch strings.ToLower(name) {
+		case "dark":
+			return ThemeDark, nil
+		case "light":
+			return ThemeLight, nil
+		}
+		return Theme{}, fmt.Errorf("theme %q: want dark or light", name)
+	}
+
+	var tc themeConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tc); err != nil {
+		return Theme{}, fmt.Errorf("theme: %w", err)
+	}
+	var t Theme
+	for _, f := range []struct {
+		dst  *Color
+		name string
+	}{
+		{&t.Key, tc.Key}, {&t.Group, tc.Group}, {&t.Time, tc.Time},
+		{&t.Message, tc.Message}, {&t.Source, tc.Source}, {&t.Muted, tc.Muted},
+	} {
+		c, err := parseColor(f.name)
+		if err != nil {
+			return Theme{}, fmt.Errorf("theme: %w", err)
+		}
+		*f.dst = c
+	}
+	for name, color := range tc.Levels {
+		level, err := parseLevel(nil, name)
+		if err != nil {
+			return Theme{}, fmt.Errorf("theme: %w", err)
+		}
+		c, err := parseColor(color)
+		if err != nil {
+			return Theme{}, fmt.Errorf("theme: %w", err)
+		}
+		if t.Levels == nil {
+			t.Levels = make(map[slog.Level]Color)
+		}
+		t.Levels[level] = c
+	}
+	return t, nil
+}
+
+// colorNames are the names of colors in config files.
+var colorNames = map[string]Color{
+	"black":          Black,
+	"red":            Red,
+	"green":          Green,
+	"yellow":         Yellow,
+	"blue":           Blue,
+	"magenta":        Magenta,
+	"cyan":           Cyan,
+	"white":          White,
+	"gray":           Gray,
+	"grey":           Gray,
+	"bright_red":     BrightRed,
+	"bright_green":   BrightGreen,
+	"bright_yellow":  BrightYellow,
+	"bright_blue":    BrightBlue,
+	"bright_magenta": BrightMagenta,
+	"bright_cyan":    BrightCyan,
+	"bright_white":   BrightWhite,
+	"bold":           Bold,
+	"dim":            Dim,
+	"italic":         Italic,
+	"underline":      Underline,
+}
+
+// parseColor returns the color written as s in a config file. An empty s is
+// an empty color.
+func parseColor(s string) (Color, error) {
+	switch {
+	case s == "":
+		return "", nil
+	case strings.HasPrefix(s, "#"):
+		if c := Hex(s); c != "" {
+			return c, nil
+		}
+	default:
+		if c, ok := colorNames[strings.ToLower(s)]; ok {
+			return c, nil
+		}
+		if n, err := strconv.ParseUint(s, 10, 8); err == nil {
+			return Color256(uint8(n)), nil
+		}
+	}
+	return "", fmt.Errorf("invalid color %q", s)
+}
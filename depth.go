@@ -0,0 +1,285 @@
+package devslog
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A ColorDepth is the number of colors that a terminal can display.
+type ColorDepth int
+
+const (
+	// ColorDepthAuto detects the color depth from environment variables such
+	// as COLORTERM and TERM.
+	ColorDepthAuto ColorDepth = iota
+	// ColorDepthNone disables colors.
+	ColorDepthNone
+	// ColorDepth16 is the basic palette of 8 colors and their bright
+	// variants.
+	ColorDepth16
+	// ColorDepth256 is the xterm palette of 256 colors.
+	ColorDepth256
+	// ColorDepthTrue is 24-bit "truecolor".
+	ColorDepthTrue
+)
+
+// detectColorDepth returns the color depth of the terminal described by the
+// COLORTERM, TERM_PROGRAM, WT_SESSION and TERM environment variables. Unknown
+// terminals are assumed to support the basic palette.
+func detectColorDepth() ColorDepth {
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return ColorDepthTrue
+	}
+
+	// Terminals known to support true color, which don't all set COLORTERM,
+	// notably when it's lost over SSH or in tmux.
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty":
+		return ColorDepthTrue
+	}
+	if os.Getenv("WT_SESSION") != "" {
+		// Windows Terminal.
+		return ColorDepthTrue
+	}
+
+	term := os.Getenv("TERM")
+	switch {
+	case term == "dumb":
+		return ColorDepthNone
+	case strings.Contains(term, "truecolor") || strings.Contains(term, "direct"):
+		return ColorDepthTrue
+	case strings.Contains(term, "256color"):
+		return ColorDepth256
+	default:
+		return ColorDepth16
+	}
+}
+
+// colorEnv adjusts depth, the detected color depth, to the conventional
+// environment variables that enable or disable colors. In order of precedence:
+//
+//   - FORCE_COLOR enables colors, unless it's "0" or "false". "2" and "3"
+//     request 256 colors and true color. CLICOLOR_FORCE enables colors
+//     unless it's "0".
+//   - NO_COLOR disables colors when it's not empty.
+//   - CLICOLOR disables colors when it's "0".
+func colorEnv(depth ColorDepth) ColorDepth {
+	if force, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		switch strings.ToLower(force) {
+		case "0", "false":
+			return ColorDepthNone
+		case "2":
+			return max(depth, ColorDepth256)
+		case "3":
+			return ColorDepthTrue
+		default:
+			return max(depth, ColorDepth16)
+		}
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return max(depth, ColorDepth16)
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("CLICOLOR") == "0" {
+		return ColorDepthNone
+	}
+	return depth
+}
+
+// RGB returns a 24-bit color. On terminals with fewer colors, it's rendered as
+// the closest color of their palette.
+func RGB(r, g, b uint8) Color {
+	return Color("38;2;" + strconv.Itoa(int(r)) + ";" + strconv.Itoa(int(g)) + ";" + strconv.Itoa(int(b)))
+}
+
+// Hex returns the 24-bit color written in hexadecimal as "#rrggbb" or "#rgb",
+// with or without the leading "#", like RGB does. It returns an empty Color,
+// which leaves text uncolored, if s is not a valid color.
+func Hex(s string) Color {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return ""
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return ""
+	}
+	return RGB(uint8(v>>16), uint8(v>>8), uint8(v))
+}
+
+// Color256 returns color n of the xterm 256-color palette. On terminals with
+// the basic palette only, it's rendered as the closest basic color.
+func Color256(n uint8) Color {
+	return Color("38;5;" + strconv.Itoa(int(n)))
+}
+
+// Adaptive returns a color that is rendered as one of colors, depending on the
+// color depth of the terminal: the variant with the most colors that the
+// terminal supports is used. This makes it possible to pick the exact basic
+// color used as a fallback for an RGB color, for instance:
+//
+//	devslog.Adaptive(devslog.RGB(255, 95, 95), devslog.Color256(203), devslog.Red)
+func Adaptive(colors ...Color) Color {
+	parts := make([]string, len(colors))
+	for i, c := range colors {
+		parts[i] = string(c)
+	}
+	return Color(strings.Join(parts, "|"))
+}
+
+// seq returns the escape sequence that sets c on a terminal with the given
+// color depth. It's empty if c is empty or if the depth has no colors.
+func (c Color) seq(depth ColorDepth) string {
+	if c == "" || depth <= ColorDepthNone {
+		return ""
+	}
+
+	// Pick the richest variant of an Adaptive color that fits depth, or the
+	// poorest variant if none does.
+	var best string
+	bestDepth := ColorDepthNone
+	poorestDepth := ColorDepthTrue + 1
+	var poorest string
+	for _, variant := range strings.Split(string(c), "|") {
+		d := variantDepth(variant)
+		if d <= depth && d > bestDepth {
+			best, bestDepth = variant, d
+		}
+		if d < poorestDepth {
+			poorest, poorestDepth = variant, d
+		}
+	}
+	if best == "" {
+		best = degrade(poorest, depth)
+	}
+	return "\033[" + best + "m"
+}
+
+// variantDepth returns the color depth needed for the SGR parameters params.
+func variantDepth(params string) ColorDepth {
+	switch {
+	case strings.Contains(params, "8;2;"):
+		return ColorDepthTrue
+	case strings.Contains(params, "8;5;"):
+		return ColorDepth256
+	default:
+		return ColorDepth16
+	}
+}
+
+// degrade rewrites the extended colors of the SGR parameters params, such as
+// "38;2;255;0;0", as the closest colors that fit depth.
+func degrade(params string, depth ColorDepth) string {
+	in := strings.Split(params, ";")
+	out := make([]string, 0, len(in))
+	for i := 0; i < len(in); i++ {
+		if (in[i] != "38" && in[i] != "48") || i+1 >= len(in) {
+			out = append(out, in[i])
+			continue
+		}
+		background := in[i] == "48"
+
+		var r, g, b uint8
+		switch {
+		case in[i+1] == "2" && i+4 < len(in):
+			r, g, b = atou8(in[i+2]), atou8(in[i+3]), atou8(in[i+4])
+			i += 4
+			if depth == ColorDepth256 {
+				out = append(out, in[i-4], "5", strconv.Itoa(int(rgbTo256(r, g, b))))
+				continue
+			}
+		case in[i+1] == "5" && i+2 < len(in):
+			r, g, b = ansi256ToRGB(atou8(in[i+2]))
+			i += 2
+		default:
+			out = append(out, in[i])
+			continue
+		}
+		out = append(out, strconv.Itoa(rgbTo16(r, g, b, background)))
+	}
+	return strings.Join(out, ";")
+}
+
+func atou8(s string) uint8 {
+	n, _ := strconv.ParseUint(s, 10, 8)
+	return uint8(n)
+}
+
+// basicPalette holds the RGB values of the 16 basic colors, as rendered by
+// xterm.
+var basicPalette = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// cubeLevels are the intensities of the 6x6x6 color cube of the 256-color
+// palette.
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// rgbTo256 returns the closest color of the 256-color palette, using the
+// grayscale ramp for grays.
+func rgbTo256(r, g, b uint8) uint8 {
+	if r == g && g == b {
+		switch {
+		case r < 8:
+			return 16
+		case r > 238:
+			return 231
+		default:
+			return uint8(232 + (int(r)-8)/10)
+		}
+	}
+
+	level := func(v uint8) int {
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		default:
+			return (int(v) - 35) / 40
+		}
+	}
+	return uint8(16 + 36*level(r) + 6*level(g) + level(b))
+}
+
+// ansi256ToRGB returns the RGB value of color n of the 256-color palette.
+func ansi256ToRGB(n uint8) (r, g, b uint8) {
+	switch {
+	case n < 16:
+		c := basicPalette[n]
+		return c[0], c[1], c[2]
+	case n < 232:
+		n -= 16
+		return cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6]
+	default:
+		v := 8 + 10*(n-232)
+		return v, v, v
+	}
+}
+
+// rgbTo16 returns the SGR parameter of the basic color closest to r, g, b.
+func rgbTo16(r, g, b uint8, background bool) int {
+	best, bestDist := 0, -1
+	for i, c := range basicPalette {
+		dr, dg, db := int(r)-int(c[0]), int(g)-int(c[1]), int(b)-int(c[2])
+		if dist := dr*dr + dg*dg + db*db; bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+
+	code := 30 + best
+	if best >= 8 {
+		code = 90 + best - 8
+	}
+	if background {
+		code += 10
+	}
+	return code
+}
@@ -2,20 +2,81 @@ package devslog
 
 import (
 	"bytes"
+	"cmp"
 	"context"
-	"fmt"
+	"errors"
 	"io"
 	"log/slog"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // A Handler handles log records produced by a Logger.
 type Handler struct {
-	opts slog.HandlerOptions
+	opts Options
 	mu   *sync.Mutex
-	w    io.Writer
 	goas []groupOrAttrs
+
+	// depth is the color depth of the output. It's ColorDepthNone when colors
+	// are disabled.
+	depth ColorDepth
+
+	// timeLayout is the layout of the times in the output.
+	timeLayout string
+
+	// graySeq, keySeq and groupSeq are the escape sequences of gray, the most
+	// used color, and of the colors of keys and group names, at depth.
+	graySeq, keySeq, groupSeq string
+
+	// hyperlinks is true when the writer is known to support OSC 8 hyperlinks
+	// and a feature that uses them is enabled.
+	hyperlinks bool
+
+	// async writes the records in the background when Options.AsyncBuffer
+	// is set. It's nil otherwise.
+	async *asyncWriter
+
+	// start is the time from which the Elapsed option counts.
+	start time.Time
+
+	// tty is the terminal whose width is the width of the output, which is
+	// asked again for each record to follow resizes. It's nil when the width
+	// is fixed.
+	tty fder
+
+	// groupLevel is the level of the GroupLevels option that applies to the
+	// handler's component or groups, or nil if none does. It's found once by
+	// withGroupOrAttrs, so that Enabled stays cheap.
+	groupLevel slog.Leveler
+
+	// state is shared with every handler derived from this one via WithAttrs
+	// or WithGroup. It's guarded by mu.
+	state *state
+}
+
+// state is the mutable data of a handler that persists between records.
+type state struct {
+	// w is the writer of the records that are not routed elsewhere.
+	w io.Writer
+	// prevTime is the time of the previous record, for the TimeDelta option.
+	prevTime time.Time
+	// absTime is the last time shown in full, for the TimeDelta option.
+	absTime time.Time
+	// prevDate is the date of the previous record, for the DateBanner option.
+	prevDate string
+	// started is true once the first record has been written.
+	started bool
+	// batches are the batches that are still open.
+	batches []*batch
+	// width is the number of columns of the output. It's atomic rather than
+	// guarded by mu, since it's read for every attribute.
+	width atomic.Int64
 }
 
 // NewHandler creates a handler that writes to w, using the given options.
@@ -24,21 +85,106 @@ func NewHandler(w io.Writer, opts *slog.HandlerOptions) *Handler {
 	if opts == nil {
 		opts = &slog.HandlerOptions{}
 	}
-	return &Handler{
-		w:    w,
-		opts: *opts,
-		mu:   &sync.Mutex{},
+	return newHandler(w, Options{HandlerOptions: *opts})
+}
+
+func newHandler(w io.Writer, opts Options) *Handler {
+	levelEnv(&opts)
+	// Without a level, the handler has a LevelVar of its own, so that SetLevel
+	// changes it for the handlers derived from this one too.
+	if opts.Level == nil {
+		opts.Level = new(slog.LevelVar)
+	}
+
+	var tty fder
+	if (len(opts.SidebarKeys) > 0 || opts.Wrap) && opts.Width == 0 {
+		opts.Width = terminalWidth(w)
+		tty = resizable(w)
+	}
+	depth := opts.ColorDepth
+	switch {
+	case opts.NoColor:
+		depth = ColorDepthNone
+	case depth == ColorDepthAuto && opts.ForceColor:
+		depth = max(detectColorDepth(), ColorDepth16)
+	case depth == ColorDepthAuto:
+		depth = detectColorDepth()
+		if !isTerminal(w) {
+			depth = ColorDepthNone
+		}
+		if !opts.IgnoreColorEnv {
+			depth = colorEnv(depth)
+		}
+	}
+
+	if opts.ASCII {
+		opts.AttrPrefix = cmp.Or(opts.AttrPrefix, asciiAttrPrefix)
+		opts.KeyValueDelimiter = cmp.Or(opts.KeyValueDelimiter, asciiKVD)
+	}
+	opts.AttrPrefix = cmp.Or(opts.AttrPrefix, attrPrefix)
+	opts.KeyValueDelimiter = cmp.Or(opts.KeyValueDelimiter, kvd)
+	if opts.Indent == "" {
+		opts.Indent = spaces[:numSpacesPerLevel]
+	}
+	if opts.Theme.isZero() {
+		opts.Theme = defaultTheme()
+	}
+	muted := themeColor(opts.Theme.Muted, colorGray)
+
+	start := opts.ElapsedStart
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	var async *asyncWriter
+	if opts.AsyncBuffer > 0 {
+		async = newAsyncWriter(opts.AsyncBuffer)
+	}
+
+	h := &Handler{
+		async:      async,
+		depth:      depth,
+		timeLayout: timeLayout(opts),
+		graySeq:    muted.seq(depth),
+		keySeq:     themeColor(opts.Theme.Key, muted).seq(depth),
+		groupSeq:   themeColor(opts.Theme.Group, muted).seq(depth),
+		opts:       opts,
+		mu:         &sync.Mutex{},
+		hyperlinks: depth != ColorDepthNone && (opts.TimeHover || opts.SourceLinks || opts.URLLinks) && supportsHyperlinks(w),
+		start:      start,
+		tty:        tty,
+		state:      &state{w: w},
 	}
+	h.state.width.Store(int64(opts.Width))
+	return h
+}
+
+// Writer returns the writer of the handler, which receives the records that
+// are not routed elsewhere by Options.LevelRoutes or Options.GroupRoutes.
+func (h *Handler) Writer() io.Writer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.state.w
+}
+
+// SetWriter replaces the writer of the handler. It's safe to call while other
+// goroutines are logging. The writer is shared by the handler that New
+// returned and every handler derived from it with WithAttrs or WithGroup, so
+// the change affects all of them. The routes of Options are not changed, and
+// neither are the features detected from the original writer, such as its
+// width or support for hyperlinks.
+func (h *Handler) SetWriter(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.state.w = w
 }
 
 // Enabled reports whether the handler handles records at the given level.
 // The handler ignores records whose level is lower.
 func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
-	minLevel := slog.LevelInfo
-	if h.opts.Level != nil {
-		minLevel = h.opts.Level.Level()
-	}
-	return level >= minLevel
+	return level >= h.minLevel()
 }
 
 // WithAttrs returns a new handler whose attributes consists of h's attributes
@@ -63,47 +209,399 @@ func (h *Handler) WithGroup(name string) slog.Handler {
 
 // Handle formats its argument Record so that message is followed by each
 // of it's attributes on seperate lines.
-func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	out := h.format(ctx, r)
+	if h.async != nil {
+		return h.async.send(asyncRecord{h: h, level: r.Level, out: out})
+	}
+	return h.write(r.Level, out)
+}
+
+// format renders r the way Handle writes it.
+func (h *Handler) format(ctx context.Context, r slog.Record) []byte {
 	var buf bytes.Buffer
 
-	// From slog handler docs:
-	// 	If r.Time is the zero time, ignore the time.
-	if !r.Time.IsZero() {
-		_, _ = buf.WriteString(r.Time.Format(time.TimeOnly) + " ")
+	r = h.addContextAttrs(ctx, r)
+	h.refreshWidth()
+
+	h.appendHeader(&buf, r)
+
+	compact := h.compact(r)
+	if compact {
+		h.appendCompact(&buf, r)
+	}
+	if sidebar := h.sidebar(r); sidebar != "" {
+		h.appendSidebar(&buf, 0, sidebar)
+	}
+	_ = buf.WriteByte('\n')
+	stack := h.stackTrace(r)
+	if !compact {
+		h.appendExpanded(&buf, r, stack)
+	} else if stack != nil {
+		h.appendStack(&buf, stackKey, stack, 0, nil, 0)
+	}
+
+	out := buf.Bytes()
+	if style := h.recordStyle(r); style != "" {
+		out = applyStyle(out, style)
+	}
+	if h.opts.FoldStyle != FoldNone {
+		out = h.fold(out)
+	}
+	if h.opts.Frame {
+		out = h.frame(out)
+	}
+	if banner := h.dateBanner(r.Time); banner != "" {
+		out = append([]byte(banner), out...)
+	}
+	return out
+}
+
+// write writes out, a formatted record at level, to its destinations.
+func (h *Handler) write(level slog.Level, out []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if preamble := h.preamble(); preamble != "" {
+		out = append([]byte(preamble), out...)
 	}
-	_, _ = buf.WriteString(text(levelColour(r.Level), r.Level.String()) + " " + r.Message + "\n")
 
+	var errs []error
+	for _, w := range h.destinations(level) {
+		var err error
+		if lw, ok := w.(levelWriter); ok {
+			_, err = lw.WriteLevel(level, out)
+		} else {
+			_, err = w.Write(out)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// preamble returns the lines written before the first record of the handler,
+// or an empty string if there are none. The caller must hold the mutex.
+func (h *Handler) preamble() string {
+	if h.state.started {
+		return ""
+	}
+	h.state.started = true
+
+	var b strings.Builder
+	if h.opts.Legend {
+		b.WriteString(h.legend())
+	}
+	if h.opts.KeyPrefix != "" {
+		b.WriteString(h.gray("keys are shown without the prefix "+quoteIfNeeded(h.opts.KeyPrefix)) + "\n")
+	}
+	return b.String()
+}
+
+// levelText returns the colored name of level. The LevelNames and LevelColors
+// options take precedence over the defaults.
+func (h *Handler) levelText(level slog.Level) string {
+	return h.text(h.levelColour(level), h.levelName(level))
+}
+
+// levelName returns the name of level, from the LevelNames option or the
+// defaults.
+func (h *Handler) levelName(level slog.Level) string {
+	name, ok := h.opts.LevelNames[level]
+	if !ok {
+		name, ok = defaultLevelNames[level]
+	}
+	if !ok {
+		name = level.String()
+	}
+	return name
+}
+
+// ParseLevel returns the level called name, ignoring case. It accepts the
+// names of the LevelNames option and of LevelTrace and LevelFatal, as well as
+// the names that [slog.Level.UnmarshalText] understands, such as "warn" or
+// "ERROR+2". This lets programs read levels from flags or the environment with
+// the same names that the handler displays.
+func (h *Handler) ParseLevel(name string) (slog.Level, error) {
+	return parseLevel(h.opts.LevelNames, name)
+}
+
+// parseLevel is like [Handler.ParseLevel], with the names of the LevelNames
+// option in names.
+func parseLevel(names map[slog.Level]string, name string) (slog.Level, error) {
+	for _, names := range []map[slog.Level]string{names, defaultLevelNames} {
+		for _, level := range slices.Sorted(maps.Keys(names)) {
+			if strings.EqualFold(names[level], name) {
+				return level, nil
+			}
+		}
+	}
+
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// levelColour returns the color of level. The LevelColors option takes
+// precedence over the theme, which takes precedence over the defaults. Levels
+// without a color of their own, such as slog.LevelWarn+2, take the color of
+// the closest level below them that has one.
+func (h *Handler) levelColour(level slog.Level) Color {
+	var colour Color
+	var best slog.Level
+	found := false
+	consider := func(l slog.Level, c Color) {
+		if l <= level && (!found || l >= best) {
+			colour, best, found = c, l, true
+		}
+	}
+
+	for _, l := range []slog.Level{LevelTrace, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError, LevelFatal} {
+		consider(l, levelColour(l))
+	}
+	for l, c := range h.opts.Theme.Levels {
+		consider(l, c)
+	}
+	for l, c := range h.opts.LevelColors {
+		consider(l, c)
+	}
+	return colour
+}
+
+// addContextAttrs returns r with the attributes of the context extractors added
+// to it. Since r may share state with the caller's copy, it's cloned first.
+func (h *Handler) addContextAttrs(ctx context.Context, r slog.Record) slog.Record {
+	var cloned bool
+	for _, extract := range h.opts.ContextExtractors {
+		attrs := extract(ctx)
+		if len(attrs) == 0 {
+			continue
+		}
+		if !cloned {
+			r = r.Clone()
+			cloned = true
+		}
+		r.AddAttrs(attrs...)
+	}
+	return r
+}
+
+// appendExpanded writes the attributes of the handler and the record, each one
+// on its own line, followed by stack, the stack trace of the StackTraceLevel
+// option, if it's not nil.
+func (h *Handler) appendExpanded(buf *bytes.Buffer, r slog.Record, stack []runtime.Frame) {
 	// In this handler, each attribute that is not one of the built-in attributes
 	// is written on its own line. For group attributes, use indentation level to
 	// display different levels.
 	var indentLevel int
-	goas := h.goas
-	if r.NumAttrs() == 0 {
-		// If the record has no Attrs, remove groups at the end of the list; they are empty.
-		for len(goas) > 0 && goas[len(goas)-1].group != "" {
-			goas = goas[:len(goas)-1]
+	var groups []string
+
+	// Groups are only written if an attribute is written in them, or in a
+	// group nested in them. Since the groups are nested, the ones written
+	// after the last attribute are empty.
+	start := buf.Len()
+	end := buf.Len()
+	for _, lvl := range h.attrLevels(r) {
+		if lvl.group != "" {
+			indentLevel, groups = h.appendGroup(buf, lvl.group, indentLevel, groups)
 		}
-	}
-	for _, goa := range goas {
-		if goa.group != "" {
-			_, _ = fmt.Fprintf(&buf, "%*s %s %s:\n", indentLevel*numSpacesPerLevel, "", attrPrefix, gray(goa.group))
-			indentLevel++
-		} else {
-			for _, a := range goa.attrs {
-				h.appendAttr(&buf, a, indentLevel)
+		align := h.keyColumn(lvl.attrs, groups)
+		for _, a := range lvl.attrs {
+			before := buf.Len()
+			h.appendAttr(buf, a, indentLevel, groups, align)
+			if buf.Len() > before {
+				end = buf.Len()
 			}
 		}
 	}
-	r.Attrs(func(a slog.Attr) bool {
-		h.appendAttr(&buf, a, indentLevel)
+	buf.Truncate(end)
+	if stack != nil {
+		h.appendStack(buf, stackKey, stack, 0, nil, 0)
+	}
+
+	if h.opts.TreeConnectors {
+		tree := h.connect(buf.Bytes()[start:])
+		buf.Truncate(start)
+		_, _ = buf.Write(tree)
+	}
+}
+
+// attrLevel is a group opened with WithGroup and the attributes directly in
+// it. The group of the first level is empty: it's the top level of a record.
+type attrLevel struct {
+	group string
+	attrs []slog.Attr
+}
+
+// attrLevels arranges the attributes of the handler and of r by the groups
+// that contain them. Sidebar attributes are left out, and repeated keys are
+// removed when the DedupeKeys option is set.
+func (h *Handler) attrLevels(r slog.Record) []attrLevel {
+	levels := []attrLevel{{}}
+	add := func(a slog.Attr) bool {
+		if !h.inSidebar(a, len(levels) == 1) {
+			cur := &levels[len(levels)-1]
+			cur.attrs = append(cur.attrs, a)
+		}
 		return true
-	})
+	}
+	for _, goa := range h.goas {
+		if goa.group != "" {
+			levels = append(levels, attrLevel{group: goa.group})
+			continue
+		}
+		for _, a := range goa.attrs {
+			add(a)
+		}
+	}
+	r.Attrs(add)
+
+	// Remove groups at the end of the list without attributes; they are empty.
+	for len(levels) > 1 && len(levels[len(levels)-1].attrs) == 0 {
+		levels = levels[:len(levels)-1]
+	}
+
+	for i := range levels {
+		levels[i].attrs = h.groupAttrs(levels[i].attrs)
+	}
+	return levels
+}
+
+// groupAttrs returns the attributes of a group, or of a level of a record, as
+// they are written: without duplicates with the DedupeKeys option, and sorted
+// by key with the SortAttrs option. attrs is not modified.
+func (h *Handler) groupAttrs(attrs []slog.Attr) []slog.Attr {
+	if h.opts.DedupeKeys {
+		attrs = dedupe(attrs)
+	}
+	if h.opts.SortAttrs {
+		attrs = slices.Clone(attrs)
+		slices.SortStableFunc(attrs, func(a, b slog.Attr) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+	}
+	return attrs
+}
+
+// dedupe returns attrs without the attributes whose key is repeated later on,
+// so that the last one wins. Inline groups, which have an empty key, are kept.
+func dedupe(attrs []slog.Attr) []slog.Attr {
+	last := make(map[string]int, len(attrs))
+	for i, a := range attrs {
+		last[a.Key] = i
+	}
+	if len(last) == len(attrs) {
+		return attrs
+	}
+
+	out := make([]slog.Attr, 0, len(attrs))
+	for i, a := range attrs {
+		if a.Key == "" || last[a.Key] == i {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Flush flushes the handler's writers if they buffer their output, such as a
+// [bufio.Writer], by calling their Flush method. It does nothing for other
+// writers. When Options.AsyncBuffer is set, it first waits for the queued
+// records to be written.
+func (h *Handler) Flush() error {
+	if h.async != nil {
+		h.async.wait()
+	}
 
 	h.mu.Lock()
-	_, err := h.w.Write(buf.Bytes())
-	h.mu.Unlock()
+	defer h.mu.Unlock()
 
-	return err
+	return h.flush()
+}
+
+// Close flushes the handler's writers, like [Handler.Flush], and then closes
+// the ones that implement [io.Closer]. [os.Stdout] and [os.Stderr] are never
+// closed. The handlers derived from h share its writers, so they should not be
+// used after Close. The batches that are still open are written first. When
+// Options.AsyncBuffer is set, it first writes the queued records and stops the
+// goroutine that writes them; the errors of those writes are returned.
+func (h *Handler) Close() error {
+	var errs []error
+	if h.async != nil {
+		errs = append(errs, h.async.close())
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for len(h.state.batches) > 0 {
+		errs = append(errs, h.writeBatch(h.state.batches[0]))
+	}
+
+	if err := h.flush(); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	for _, w := range h.writers() {
+		if w == os.Stdout || w == os.Stderr {
+			continue
+		}
+		if c, ok := w.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flush is the implementation of Flush. The caller must hold the mutex.
+func (h *Handler) flush() error {
+	var errs []error
+	for _, w := range h.writers() {
+		if f, ok := w.(flusher); ok {
+			errs = append(errs, f.Flush())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flusher is implemented by writers that buffer their output.
+type flusher interface {
+	Flush() error
+}
+
+// levelWriter is implemented by writers that want to know the level of the
+// record being written, such as the writer used by [NewSyslogHandler].
+type levelWriter interface {
+	WriteLevel(level slog.Level, p []byte) (n int, err error)
+}
+
+// replaceAttr resolves the value of a, and then applies the DropKeys and
+// KeepKeys options, the ReplaceAttr option, unless a is a group, and the
+// RedactKeys, MaskPatterns, KeyFormats, ValueFormatters, ExpandStructs and
+// SliceMinLen options. groups are the names of the groups that a is in. It
+// returns the zero Attr for the attributes that are left out.
+func (h *Handler) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	// From slog handler docs:
+	// 	Attr's values should be resolved.
+	a.Value = resolve(a.Value)
+	if h.filtered(groups, a) {
+		return slog.Attr{}
+	}
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+		a.Value = resolve(a.Value)
+	}
+	if h.isRedacted(a.Key) {
+		a.Value = slog.StringValue(h.redact(a.Value.String()))
+		return a
+	}
+	if a.Value.Kind() == slog.KindString && len(h.opts.MaskPatterns) > 0 {
+		a.Value = slog.StringValue(h.mask(a.Value.String()))
+	}
+	if f, ok := h.customFormat(a.Key, a.Value); ok {
+		a.Value = slog.AnyValue(f)
+		return a
+	}
+	a.Value = h.expandValue(a.Value)
+	return a
 }
 
 const (
@@ -112,14 +610,18 @@ const (
 	attrPrefix = "↳"
 	// kvd is the key value delimiter output between an attribute's key and value.
 	kvd = ":"
-	// numSpacesPerLevel is an indentation value for spacing group attributes.
+	// asciiAttrPrefix and asciiKVD replace attrPrefix and kvd with the ASCII
+	// option.
+	asciiAttrPrefix = "->"
+	asciiKVD        = " ="
+	// numSpacesPerLevel is the default indentation of group attributes.
 	numSpacesPerLevel = 4
 )
 
-func (h *Handler) appendAttr(buf *bytes.Buffer, a slog.Attr, indentLevel int) {
-	// From slog handler docs:
-	// 	Attr's values should be resolved.
-	a.Value = a.Value.Resolve()
+// appendAttr writes a and, if it's a group, its attributes. The keys of scalar
+// attributes are padded to the width align, to line up their values.
+func (h *Handler) appendAttr(buf *bytes.Buffer, a slog.Attr, indentLevel int, groups []string, align int) {
+	a = h.replaceAttr(groups, a)
 
 	// From slog handler docs:
 	// 	If an Attr's key and value are both the zero value, ignore the Attr.
@@ -127,15 +629,11 @@ func (h *Handler) appendAttr(buf *bytes.Buffer, a slog.Attr, indentLevel int) {
 		return
 	}
 
-	_, _ = fmt.Fprintf(buf, "%*s", indentLevel*numSpacesPerLevel, "")
-	switch a.Value.Kind() {
-	case slog.KindString:
-		_, _ = fmt.Fprintf(buf, " %s %s%s %s\n", attrPrefix, gray(a.Key), kvd, a.Value.String())
-	case slog.KindTime:
-		// Write times in the same layout as the built-in time attribute.
-		_, _ = fmt.Fprintf(buf, " %s %s%s %s\n", attrPrefix, gray(a.Key), kvd, a.Value.Time().Format(time.TimeOnly))
-	case slog.KindGroup:
-		attrs := a.Value.Group()
+	switch {
+	case h.beyondMaxDepth(groups, a):
+		h.appendKeyVal(buf, a.Key, h.gray(depthSummary(a.Value.Group())), indentLevel, groups, align)
+	case a.Value.Kind() == slog.KindGroup:
+		attrs := h.groupAttrs(a.Value.Group())
 
 		// From slog handler docs:
 		// 	If a group has no Attrs (even if it has a non-empty key), ignore it.
@@ -145,17 +643,200 @@ func (h *Handler) appendAttr(buf *bytes.Buffer, a slog.Attr, indentLevel int) {
 
 		// If the key is non-empty, write it out and indent the rest of the attrs.
 		// Otherwise, inline the attrs.
+		start := buf.Len()
 		if a.Key != "" {
-			_, _ = fmt.Fprintf(buf, " %s %s:\n", attrPrefix, gray(a.Key))
-			indentLevel++
+			indentLevel, groups = h.appendGroup(buf, a.Key, indentLevel, groups)
+			if !h.flat() {
+				align = h.keyColumn(attrs, groups)
+			}
 		}
+		headerEnd := buf.Len()
 
 		for _, ga := range attrs {
-			h.appendAttr(buf, ga, indentLevel)
+			h.appendAttr(buf, ga, indentLevel, groups, align)
+		}
+
+		// Don't leave the name of a group whose attributes were all ignored.
+		if buf.Len() == headerEnd {
+			buf.Truncate(start)
 		}
 	default:
-		_, _ = fmt.Fprintf(buf, " %s %s%s %s\n", attrPrefix, gray(a.Key), kvd, a.Value)
+		defer h.recoverValue(buf, buf.Len(), a.Key, indentLevel, groups, align)
+
+		if b, ok := a.Value.Any().([]byte); ok && h.hexDump(b) {
+			h.appendHexDump(buf, a.Key, b, indentLevel, groups, align)
+			return
+		}
+		if h.isSQL(a.Key, a.Value) {
+			h.appendSQL(buf, a.Key, a.Value.String(), indentLevel, groups, align)
+			return
+		}
+		if s, ok := h.jsonText(a.Value); ok {
+			h.appendJSON(buf, a.Key, s, indentLevel, groups, align)
+			return
+		}
+		s := h.formatValue(a.Key, a.Value)
+		if err, ok := errorValue(a.Value); ok {
+			if _, joined := joinedErrors(err); strings.Contains(s, "\n") && !joined {
+				h.appendMultiline(buf, a, s, indentLevel, groups, align)
+			} else {
+				h.appendKeyValSeq(buf, h.attrKeySeq(a.Value), a.Key, h.errorText(err), indentLevel, groups, align)
+			}
+			h.appendBlock(buf, h.errorCauses(err), indentLevel)
+			if frames, ok := stackFrames(err); ok {
+				h.appendBlock(buf, h.stackLines(frames), indentLevel)
+			}
+			return
+		}
+		if a.Value.Kind() == slog.KindAny && !isNil(a.Value) {
+			if frames, ok := stackFrames(a.Value.Any()); ok {
+				h.appendStack(buf, a.Key, frames, indentLevel, groups, align)
+				return
+			}
+		}
+		if strings.Contains(s, "\n") {
+			h.appendMultiline(buf, a, s, indentLevel, groups, align)
+			return
+		}
+		val := h.valueText(a.Value, s)
+		if a.Value.Kind() == slog.KindDuration {
+			if bar := h.durationBar(a.Value.Duration()); bar != "" {
+				val += " " + bar
+			}
+		}
+		h.appendKeyVal(buf, a.Key, val, indentLevel, groups, align)
+	}
+}
+
+// appendKeyVal writes a line for an attribute with a scalar value, with the
+// key padded to the width align.
+func (h *Handler) appendKeyVal(buf *bytes.Buffer, key, val string, indentLevel int, groups []string, align int) {
+	h.appendKeyValSeq(buf, h.keySeq, key, val, indentLevel, groups, align)
+}
+
+// appendKeyValSeq is like appendKeyVal, with the key styled by keySeq.
+func (h *Handler) appendKeyValSeq(buf *bytes.Buffer, keySeq, key, val string, indentLevel int, groups []string, align int) {
+	key = h.lineKey(groups, key)
+
+	// This is called for every attribute, so it writes to buf directly
+	// instead of formatting with fmt.
+	lineStart := buf.Len()
+	h.appendIndent(buf, indentLevel)
+	h.appendAttrPrefix(buf)
+	h.appendStyled(buf, keySeq, key)
+	_, _ = buf.WriteString(h.opts.KeyValueDelimiter + " ")
+	for n := align - visibleWidth(key); n > 0; n -= len(spaces) {
+		_, _ = buf.WriteString(spaces[:min(n, len(spaces))])
+	}
+	if h.opts.Wrap && h.width() > 0 {
+		h.appendWrapped(buf, lineStart, val, indentLevel)
+		return
+	}
+	_, _ = buf.WriteString(val)
+	_ = buf.WriteByte('\n')
+}
+
+// lineKey returns the key of an attribute line, which includes the names of
+// groups in the layouts without group lines.
+func (h *Handler) lineKey(groups []string, key string) string {
+	key = h.displayKey(key)
+	switch {
+	case h.opts.JSONPathKeys:
+		key = jsonPath(h.displayKeys(groups), key)
+	case h.opts.FlattenGroups:
+		key = h.flatKey(groups, key)
+	}
+	return key
+}
+
+// flat reports whether the attributes of groups are written at the level of
+// the group, with the names of the groups in their keys.
+func (h *Handler) flat() bool {
+	return h.opts.JSONPathKeys || h.opts.FlattenGroups
+}
+
+// keyColumn returns the width of the widest key of the scalar attributes that
+// attrs writes at the same level, for the AlignKeys option. It returns 0 when
+// the option is not set.
+func (h *Handler) keyColumn(attrs []slog.Attr, groups []string) int {
+	if !h.opts.AlignKeys {
+		return 0
+	}
+	var width int
+	for _, a := range attrs {
+		a = h.replaceAttr(groups, a)
+		switch {
+		case a.Equal(slog.Attr{}):
+		case a.Value.Kind() == slog.KindGroup && !h.beyondMaxDepth(groups, a):
+			attrs := h.groupAttrs(a.Value.Group())
+			if a.Key == "" {
+				width = max(width, h.keyColumn(attrs, groups))
+			} else if h.flat() {
+				width = max(width, h.keyColumn(attrs, append(groups[:len(groups):len(groups)], a.Key)))
+			}
+		default:
+			width = max(width, visibleWidth(h.lineKey(groups, a.Key)))
+		}
+	}
+	return width
+}
+
+// appendGroup opens a group named name. It writes the group's header line, if
+// the layout has one, and returns the indentation level and group path for the
+// attributes of the group.
+func (h *Handler) appendGroup(buf *bytes.Buffer, name string, indentLevel int, groups []string) (int, []string) {
+	groups = append(groups[:len(groups):len(groups)], name)
+	name = h.displayKey(name)
+	if h.flat() {
+		return indentLevel, groups
+	}
+
+	h.appendIndent(buf, indentLevel)
+	h.appendAttrPrefix(buf)
+	h.appendStyled(buf, h.groupSeq, name)
+	_, _ = buf.WriteString(h.opts.KeyValueDelimiter + "\n")
+	return indentLevel + 1, groups
+}
+
+// spaces is sliced for the default indentation and for the padding of
+// aligned keys, so that writing them doesn't allocate.
+const spaces = "                                "
+
+// appendIndent writes the indentation of the attributes at indentLevel. With
+// the TreeGuides option, it has a guide below each open group. With the
+// TreeConnectors option, it has placeholder cells, which connect replaces.
+func (h *Handler) appendIndent(buf *bytes.Buffer, indentLevel int) {
+	if h.opts.TreeConnectors {
+		_ = buf.WriteByte(' ')
+		for range indentLevel {
+			_, _ = buf.WriteString(connectorPipe)
+		}
+		return
+	}
+	if h.opts.TreeGuides {
+		for range indentLevel {
+			if h.opts.ASCII {
+				h.appendGray(buf, " |")
+			} else {
+				h.appendGray(buf, " │")
+			}
+			_, _ = buf.WriteString("  ")
+		}
+		return
+	}
+	for range indentLevel {
+		_, _ = buf.WriteString(h.opts.Indent)
+	}
+}
+
+// appendAttrPrefix writes the symbol before the key of an attribute, after its
+// indentation.
+func (h *Handler) appendAttrPrefix(buf *bytes.Buffer) {
+	if h.opts.TreeConnectors {
+		_, _ = buf.WriteString(connectorTee)
+		return
 	}
+	_, _ = buf.WriteString(" " + h.opts.AttrPrefix + " ")
 }
 
 // withGroupOrAttrs is for use in the Handler's WithAttrs or WithGroup methods.
@@ -169,6 +850,7 @@ func (h *Handler) withGroupOrAttrs(goa groupOrAttrs) *Handler {
 	out.goas = make([]groupOrAttrs, len(h.goas)+1)
 	copy(out.goas, h.goas)
 	out.goas[len(out.goas)-1] = goa
+	out.groupLevel = out.findGroupLevel()
 	return &out
 }
 
@@ -183,7 +865,10 @@ type groupOrAttrs struct {
 // SetDefault is syntactic sugar for constructing a new devslog handler
 // and setting it as the default [slog.Logger]. The top-level slog
 // functions [slog.Info], [slog.Debug], etc will all use this handler
-// to format the records.
+// to format the records. The handler is created by [NewHandlerFromEnv],
+// so its options can be overridden by environment variables. When w
+// buffers its output, the handler of [slog.Default] can be flushed with
+// [Handler.Close] before the program exits.
 func SetDefault(w io.Writer, opts *slog.HandlerOptions) {
-	slog.SetDefault(slog.New(NewHandler(w, opts)))
+	slog.SetDefault(slog.New(NewHandlerFromEnv(w, opts)))
 }
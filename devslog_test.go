@@ -1,56 +1,139 @@
 package devslog
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/slogtest"
 	"time"
 )
 
+type testRequest struct {
+	Method  string
+	Headers map[string]string
+	User    *testUser
+	Err     error
+	private bool
+}
+
+type testUser struct {
+	Name string
+	Team testTeam
+}
+
+type testTeam struct {
+	Name string
+}
+
+type testUUID [4]byte
+
+func sha256Prefix(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
 func TestSlogtest(t *testing.T) {
-	var buf bytes.Buffer
-	newHandler := func(t *testing.T) slog.Handler {
-		t.Helper()
-		buf.Reset()
-		return NewHandler(&buf, nil)
+	testCases := []struct {
+		name string
+		opts *Options
+	}{
+		{name: "default", opts: &Options{}},
+		{name: "header order", opts: &Options{HeaderOrder: []HeaderField{HeaderMessage, HeaderLevel, HeaderTime}}},
+		{name: "frame", opts: &Options{Frame: true}},
+		{name: "show date", opts: &Options{ShowDate: true}},
+		{name: "time locale", opts: &Options{TimeLocale: "en-US", ShowDate: true}},
 	}
-	makeTestResults := func(t *testing.T) map[string]any {
-		t.Helper()
 
-		got := buf.String()
-		t.Log(got)
-		return parseMap(t, strings.Split(got, "\n"))
-	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			newHandler := func(t *testing.T) slog.Handler {
+				t.Helper()
+				buf.Reset()
+				return New(&buf, tc.opts)
+			}
+			makeTestResults := func(t *testing.T) map[string]any {
+				t.Helper()
+
+				got := buf.String()
+				t.Log(got)
+				return parseMap(t, tc.opts, strings.Split(got, "\n"))
+			}
 
-	slogtest.Run(t, newHandler, makeTestResults)
+			slogtest.Run(t, newHandler, makeTestResults)
+		})
+	}
 }
 
-// parseMap formats the output lines into a map for the slogtest tests.
-func parseMap(t *testing.T, lines []string) map[string]any {
+// parseMap formats the output lines into a map for the slogtest tests. The
+// output is expected to be written by a handler with opts.
+func parseMap(t *testing.T, opts *Options, lines []string) map[string]any {
 	t.Helper()
 
+	if opts.Frame {
+		h := New(io.Discard, opts)
+		start, end := h.frameMarkers()
+		lines = slices.DeleteFunc(lines, func(line string) bool {
+			line = stripANSI(line)
+			return line == start || line == end
+		})
+	}
 	if len(lines) < 2 {
 		return nil
 	}
+	order := opts.HeaderOrder
+	if len(order) == 0 {
+		order = []HeaderField{HeaderTime, HeaderLevel, HeaderMessage}
+	}
 
 	out := make(map[string]any)
 
 	// The first output line with the built-in attributes has a different format
 	// than the newline-delimited attributes afterwards. There are 2 or 3
 	// attributes on this line, depending on whether or not the time is present.
-	switch firstLineParts := strings.Split(lines[0], " "); len(firstLineParts) {
-	case 2:
-		out[slog.LevelKey] = stripANSI(firstLineParts[0])
-		out[slog.MessageKey] = firstLineParts[1]
-	case 3:
-		out[slog.TimeKey] = firstLineParts[0]
-		out[slog.LevelKey] = stripANSI(firstLineParts[1])
-		out[slog.MessageKey] = firstLineParts[2]
-	default:
-		t.Fatalf("unexpected number of parts for first line (%d), expected 2 or 3", len(firstLineParts))
+	firstLineParts := strings.Split(lines[0], " ")
+	hasTime := len(firstLineParts) == len(order)
+	if !hasTime && len(firstLineParts) != len(order)-1 {
+		t.Fatalf("unexpected number of parts for first line (%d), expected %d or %d", len(firstLineParts), len(order)-1, len(order))
+	}
+	var i int
+	for _, field := range order {
+		switch field {
+		case HeaderTime:
+			if !hasTime {
+				continue
+			}
+			out[slog.TimeKey] = firstLineParts[i]
+		case HeaderLevel:
+			out[slog.LevelKey] = stripANSI(firstLineParts[i])
+		case HeaderMessage:
+			out[slog.MessageKey] = firstLineParts[i]
+		}
+		i++
 	}
 
 	// Any attributes added via WithAttr, WithGroup, or with the record via the
@@ -61,24 +144,6 @@ func parseMap(t *testing.T, lines []string) map[string]any {
 	return out
 }
 
-// ansiColors are the same const values in color.go.
-var ansiColors = []string{
-	resetColour,
-	colourRed,
-	colourYellow,
-	colourWhite,
-	colorGray,
-}
-
-// stripANSI removes ANSI escape codes from line so that we can focus on the
-// data more clearly in these tests.
-func stripANSI(line string) string {
-	for _, color := range ansiColors {
-		line = strings.ReplaceAll(line, color, "")
-	}
-	return line
-}
-
 // mapAttrLines reads attribute lines from the handler output into a map for use
 // in slogtest tests. It's not meant to interpet the first line of the output;
 // that is reserved for the built-in attribute which have a different format
@@ -181,6 +246,18 @@ func mapAttrLines(t *testing.T, lines []string) map[string]any {
 	return out
 }
 
+// panickyValuer is a [slog.LogValuer] with a bug.
+type panickyValuer struct{}
+
+func (panickyValuer) LogValue() slog.Value { panic("oops") }
+
+// nestingValuer is a [slog.LogValuer] whose groups are nested without end.
+type nestingValuer struct{}
+
+func (nestingValuer) LogValue() slog.Value {
+	return slog.GroupValue(slog.Any("next", nestingValuer{}))
+}
+
 func TestHandler(t *testing.T) {
 	// now is a fixed value meant to simplify output tests. It's the same
 	// value as the time in the Go Playground.
@@ -188,6 +265,10 @@ func TestHandler(t *testing.T) {
 
 	testCases := []struct {
 		name  string
+		opts  *Options
+		level slog.Leveler
+		// with, if set, derives the handler that's tested from the new one.
+		with  func(h slog.Handler) slog.Handler
 		attrs []slog.Attr
 		want  string
 	}{
@@ -210,25 +291,2679 @@ func TestHandler(t *testing.T) {
      ↳ e: f
  ↳ g: h`,
 		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			rec := slog.NewRecord(now, slog.LevelInfo, "msg", 0)
-			rec.AddAttrs(tc.attrs...)
-			var buf bytes.Buffer
-
-			err := NewHandler(&buf, nil).Handle(t.Context(), rec)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			got := stripANSI(buf.String())
-			got = strings.TrimSuffix(got, "\n") // discard new line so that writing expected values is easier.
-
-			if got != tc.want {
-				t.Errorf("\ngot:  %q\nwant: %q", got, tc.want)
-			}
-		})
+		{
+			name: "group whose attrs are all dropped",
+			attrs: []slog.Attr{
+				slog.Group("G", slog.Attr{}),
+				slog.Group("H", slog.Group("I", slog.Attr{})),
+				slog.String("a", "b"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: b`,
+		},
+		{
+			name: "handler group whose attrs are all dropped",
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithGroup("G").WithAttrs([]slog.Attr{slog.Group("H", slog.Attr{})})
+			},
+			want: `23:00:00 INFO msg`,
+		},
+		{
+			name: "handler group with attrs in a nested group",
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithGroup("G").WithAttrs([]slog.Attr{slog.Group("H", slog.Attr{})}).WithGroup("I")
+			},
+			attrs: []slog.Attr{slog.String("a", "b")},
+			want: `23:00:00 INFO msg
+ ↳ G:
+     ↳ I:
+         ↳ a: b`,
+		},
+		{
+			name: "flatten groups",
+			opts: &Options{FlattenGroups: true},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithGroup("db").WithAttrs([]slog.Attr{slog.String("name", "users")})
+			},
+			attrs: []slog.Attr{
+				slog.Group("conn", slog.Duration("timeout", 5*time.Second), slog.Group("pool", slog.Int("size", 4))),
+			},
+			want: `23:00:00 INFO msg
+ ↳ db.name: users
+ ↳ db.conn.timeout: 5s
+ ↳ db.conn.pool.size: 4`,
+		},
+		{
+			name: "group separator",
+			opts: &Options{Compact: true, GroupSeparator: "/"},
+			attrs: []slog.Attr{
+				slog.Group("G", slog.Group("H", slog.Int("a", 1))),
+			},
+			want: `23:00:00 INFO msg G/H/a=1`,
+		},
+		{
+			name: "thousands separator and float precision",
+			opts: &Options{ThousandsSeparator: ",", FloatPrecision: 2},
+			attrs: []slog.Attr{
+				slog.Int("bytes", 1073741824),
+				slog.Int("neg", -1234),
+				slog.Uint64("small", 999),
+				slog.Float64("ratio", 12345.6789),
+				slog.Float64("nan", math.NaN()),
+				slog.Float64("inf", math.Inf(1)),
+			},
+			want: `23:00:00 INFO msg
+ ↳ bytes: 1,073,741,824
+ ↳ neg: -1,234
+ ↳ small: 999
+ ↳ ratio: 12,345.68
+ ↳ nan: NaN
+ ↳ inf: +Inf`,
+		},
+		{
+			name: "thousands separator without float precision",
+			opts: &Options{ThousandsSeparator: "_"},
+			attrs: []slog.Attr{
+				slog.Float64("f", 1234567.5),
+				slog.Float64("big", 1e21),
+			},
+			want: `23:00:00 INFO msg
+ ↳ f: 1_234_567.5
+ ↳ big: 1e+21`,
+		},
+		{
+			name: "tree guides",
+			opts: &Options{TreeGuides: true, HexDumpMinLen: 4},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("a", "b")}).WithGroup("req")
+			},
+			attrs: []slog.Attr{
+				slog.String("method", "GET"),
+				slog.Group("G", slog.Int("c", 1), slog.Any("d", []byte("abcd"))),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: b
+ ↳ req:
+ │   ↳ method: GET
+ │   ↳ G:
+ │   │   ↳ c: 1
+ │   │   ↳ d: (4 bytes)
+ │   │       00000000  61 62 63 64                                       |abcd|`,
+		},
+		{
+			name: "replace attr",
+			opts: &Options{HandlerOptions: slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					switch {
+					case a.Key == slog.TimeKey && len(groups) == 0:
+						return slog.Attr{}
+					case a.Key == slog.LevelKey && len(groups) == 0:
+						return slog.String(a.Key, "INFORMATION")
+					case a.Key == "secret":
+						return slog.Attr{}
+					case a.Key == "n" && slices.Equal(groups, []string{"G", "H"}):
+						return slog.Int(a.Key, 2*int(a.Value.Int64()))
+					}
+					return a
+				},
+			}},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithGroup("G")
+			},
+			attrs: []slog.Attr{
+				slog.Group("H", slog.Int("n", 21)),
+				slog.Group("I", slog.String("secret", "hunter2")),
+				slog.Int("n", 1),
+			},
+			want: `INFORMATION msg
+ ↳ G:
+     ↳ H:
+         ↳ n: 42
+     ↳ n: 1`,
+		},
+		{
+			name: "replace attr in compact mode",
+			opts: &Options{Compact: true, HandlerOptions: slog.HandlerOptions{
+				ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+					if a.Key == "secret" || a.Key == slog.MessageKey {
+						return slog.Attr{}
+					}
+					return a
+				},
+			}},
+			attrs: []slog.Attr{
+				slog.Group("G", slog.String("secret", "hunter2"), slog.Int("n", 1)),
+			},
+			want: `23:00:00 INFO G.n=1`,
+		},
+		{
+			name: "compact",
+			opts: &Options{Compact: true},
+			attrs: []slog.Attr{
+				slog.String("a", "b c"),
+				slog.Group("G", slog.Int("c", 1), slog.Group("H", slog.Bool("e", true))),
+				slog.String("g", ""),
+			},
+			want: `23:00:00 INFO msg a="b c" G.c=1 G.H.e=true g=""`,
+		},
+		{
+			name: "inline small records",
+			opts: &Options{InlineMaxAttrs: 2},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("a", "b")})
+			},
+			attrs: []slog.Attr{slog.Group("G", slog.Int("c", 1))},
+			want:  `23:00:00 INFO msg a=b G.c=1`,
+		},
+		{
+			name: "inline small records above the threshold",
+			opts: &Options{InlineMaxAttrs: 2},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("a", "b")})
+			},
+			attrs: []slog.Attr{slog.Group("G", slog.Int("c", 1), slog.Int("d", 2))},
+			want: `23:00:00 INFO msg
+ ↳ a: b
+ ↳ G:
+     ↳ c: 1
+     ↳ d: 2`,
+		},
+		{
+			name:  "indent",
+			opts:  &Options{Indent: "  ", HexDumpMinLen: 4},
+			attrs: []slog.Attr{slog.Group("G", slog.Group("H", slog.Any("a", []byte("abcd"))))},
+			want: `23:00:00 INFO msg
+ ↳ G:
+   ↳ H:
+     ↳ a: (4 bytes)
+       00000000  61 62 63 64                                       |abcd|`,
+		},
+		{
+			name:  "indent with tabs",
+			opts:  &Options{Indent: "\t"},
+			attrs: []slog.Attr{slog.Group("G", slog.Int("a", 1))},
+			want:  "23:00:00 INFO msg\n ↳ G:\n\t ↳ a: 1",
+		},
+		{
+			name:  "ascii",
+			opts:  &Options{ASCII: true, TreeGuides: true},
+			attrs: []slog.Attr{slog.String("a", "b"), slog.Group("G", slog.Int("c", 1))},
+			want: `23:00:00 INFO msg
+ -> a = b
+ -> G =
+ |   -> c = 1`,
+		},
+		{
+			name:  "ascii frame",
+			opts:  &Options{ASCII: true, Frame: true},
+			attrs: []slog.Attr{slog.String("a", "b")},
+			want: `+--
+23:00:00 INFO msg
+ -> a = b
++--`,
+		},
+		{
+			name:  "attr prefix and delimiter",
+			opts:  &Options{ASCII: true, AttrPrefix: "*", KeyValueDelimiter: " ="},
+			attrs: []slog.Attr{slog.String("a", "b")},
+			want: `23:00:00 INFO msg
+ * a = b`,
+		},
+		{
+			name: "tree connectors",
+			opts: &Options{TreeConnectors: true, HexDumpMinLen: 4},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("a", "b")}).WithGroup("G")
+			},
+			attrs: []slog.Attr{
+				slog.Group("H", slog.Int("c", 1), slog.Any("d", []byte("abcd"))),
+				slog.Group("I", slog.Group("J", slog.Int("e", 2))),
+				slog.Group("K"),
+			},
+			want: `23:00:00 INFO msg
+ ├─ a: b
+ └─ G:
+    ├─ H:
+    │  ├─ c: 1
+    │  └─ d: (4 bytes)
+    │     00000000  61 62 63 64                                       |abcd|
+    └─ I:
+       └─ J:
+          └─ e: 2`,
+		},
+		{
+			name:  "tree connectors in ascii",
+			opts:  &Options{TreeConnectors: true, ASCII: true},
+			attrs: []slog.Attr{slog.Group("G", slog.Int("a", 1)), slog.Int("b", 2)},
+			want: `23:00:00 INFO msg
+ |- G =
+ |  ` + "`" + `- a = 1
+ ` + "`" + `- b = 2`,
+		},
+		{
+			name: "align keys",
+			opts: &Options{AlignKeys: true, HexDumpMinLen: 4},
+			attrs: []slog.Attr{
+				slog.String("a", "b"),
+				slog.Group("group", slog.Int("c", 1), slog.Any("bytes", []byte("abcd"))),
+				slog.Group("", slog.String("long", "d")),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a:    b
+ ↳ group:
+     ↳ c:     1
+     ↳ bytes: (4 bytes)
+         00000000  61 62 63 64                                       |abcd|
+ ↳ long: d`,
+		},
+		{
+			name: "align flattened keys",
+			opts: &Options{AlignKeys: true, FlattenGroups: true},
+			attrs: []slog.Attr{
+				slog.String("a", "b"),
+				slog.Group("group", slog.Int("c", 1)),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a:       b
+ ↳ group.c: 1`,
+		},
+		{
+			name: "sort attrs",
+			opts: &Options{SortAttrs: true},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("z", "1"), slog.String("m", "2")}).WithGroup("G")
+			},
+			attrs: []slog.Attr{
+				slog.Group("y", slog.Int("c", 1), slog.Int("b", 2)),
+				slog.Int("a", 3),
+			},
+			want: `23:00:00 INFO msg
+ ↳ m: 2
+ ↳ z: 1
+ ↳ G:
+     ↳ a: 3
+     ↳ y:
+         ↳ b: 2
+         ↳ c: 1`,
+		},
+		{
+			name:  "sort attrs in compact mode",
+			opts:  &Options{SortAttrs: true, Compact: true},
+			attrs: []slog.Attr{slog.Int("b", 1), slog.Group("a", slog.Int("d", 2), slog.Int("c", 3))},
+			want:  `23:00:00 INFO msg a.c=3 a.d=2 b=1`,
+		},
+		{
+			name: "max depth",
+			opts: &Options{MaxDepth: 2},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithGroup("G")
+			},
+			attrs: []slog.Attr{
+				slog.Group("H",
+					slog.Int("a", 1),
+					slog.Group("I", slog.Group("J", slog.Group("K", slog.Int("b", 2)))),
+					slog.Group("L", slog.Int("c", 3)),
+				),
+			},
+			want: `23:00:00 INFO msg
+ ↳ G:
+     ↳ H:
+         ↳ a: 1
+         ↳ I: … (3 more levels)
+         ↳ L: … (1 more level)`,
+		},
+		{
+			name:  "max depth of endless groups",
+			opts:  &Options{MaxDepth: 1},
+			attrs: []slog.Attr{slog.Any("v", nestingValuer{})},
+			want: `23:00:00 INFO msg
+ ↳ v:
+     ↳ next: … (over 100 more levels)`,
+		},
+		{
+			name:  "max depth in compact mode",
+			opts:  &Options{MaxDepth: 1, Compact: true},
+			attrs: []slog.Attr{slog.Group("G", slog.Group("H", slog.Int("a", 1)))},
+			want:  `23:00:00 INFO msg G.H="… (1 more level)"`,
+		},
+		{
+			name: "json path keys",
+			opts: &Options{JSONPathKeys: true},
+			attrs: []slog.Attr{
+				slog.String("a", "b"),
+				slog.Group("request", slog.Group("headers", slog.String("Content-Type", "text/plain"))),
+				slog.Group("", slog.String("1st", "c")),
+			},
+			want: `23:00:00 INFO msg
+ ↳ .a: b
+ ↳ .request.headers["Content-Type"]: text/plain
+ ↳ .["1st"]: c`,
+		},
+		{
+			name: "max value length",
+			opts: &Options{MaxValueLen: 3},
+			attrs: []slog.Attr{
+				slog.String("a", "abc"),
+				slog.String("b", "abcd"),
+				slog.String("c", "日本語です"),
+				slog.String("d", "a\nbcd"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: abc
+ ↳ b: abc…(4 bytes)
+ ↳ c: 日本語…(15 bytes)
+ ↳ d: |
+     a
+     b…(5 bytes)`,
+		},
+		{
+			name: "untruncated value",
+			opts: &Options{MaxValueLen: 3},
+			attrs: []slog.Attr{
+				slog.String("a", "abcd"),
+				Untruncated("b", "abcd"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: abc…(4 bytes)
+ ↳ b: abcd`,
+		},
+		{
+			name: "truncate head",
+			opts: &Options{MaxValueLen: 4, TruncateMode: TruncateHead},
+			attrs: []slog.Attr{
+				slog.String("a", "abcdef"),
+				slog.String("b", "日本語です"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: …cdef(6 bytes)
+ ↳ b: …本語です(15 bytes)`,
+		},
+		{
+			name: "truncate middle",
+			opts: &Options{MaxValueLen: 3, TruncateMode: TruncateMiddle},
+			attrs: []slog.Attr{
+				slog.String("a", "abcdef"),
+				slog.String("b", "日本語です"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: ab…f(6 bytes)
+ ↳ b: 日本…す(15 bytes)`,
+		},
+		{
+			name: "id format",
+			opts: &Options{IDFormat: &IDFormat{Base: 16, Min: 1 << 32}},
+			attrs: []slog.Attr{
+				slog.Int64("a", 1<<32),
+				slog.Int64("b", 1<<32-1),
+				slog.Int64("c", -1<<63),
+				slog.Uint64("d", 1<<64-1),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: 0x100000000
+ ↳ b: 4294967295
+ ↳ c: -0x8000000000000000
+ ↳ d: 0xffffffffffffffff`,
+		},
+		{
+			name: "id format for keys",
+			opts: &Options{IDFormat: &IDFormat{Base: 36, Keys: []string{"id"}}},
+			attrs: []slog.Attr{
+				slog.Int("id", 1234567890),
+				slog.Int("count", 1234567890),
+			},
+			want: `23:00:00 INFO msg
+ ↳ id: kf12oi
+ ↳ count: 1234567890`,
+		},
+		{
+			name: "bytes",
+			attrs: []slog.Attr{
+				slog.Any("empty", []byte(nil)),
+				slog.Any("short", []byte("hello")),
+				slog.Group("G", slog.Any("long", []byte("hello, world! hello, world!"))),
+			},
+			want: `23:00:00 INFO msg
+ ↳ empty: (0 bytes)
+ ↳ short: 68656c6c6f
+ ↳ G:
+     ↳ long: (27 bytes)
+         00000000  68 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 20 68 65  |hello, world! he|
+         00000010  6c 6c 6f 2c 20 77 6f 72  6c 64 21                 |llo, world!|`,
+		},
+		{
+			name: "errors",
+			attrs: []slog.Attr{
+				slog.Any("err", &fs.PathError{Op: "open", Path: "x", Err: fs.ErrNotExist}),
+				slog.Any("nil", (*fs.PathError)(nil)),
+				slog.String("str", "not an error"),
+				slog.Group("G", slog.Any("wrapped", fmt.Errorf("load: %w", fmt.Errorf("read: %w", errors.New("EOF"))))),
+				slog.Any("multi-line", fmt.Errorf("a\nb: %w", errors.New("c"))),
+			},
+			want: `23:00:00 INFO msg
+ ↳ err: "open x: file does not exist" (*fs.PathError)
+     caused by: "file does not exist" (*errors.errorString)
+ ↳ nil: <nil>
+ ↳ str: not an error
+ ↳ G:
+     ↳ wrapped: "load: read: EOF" (*fmt.wrapError)
+         caused by: "read: EOF" (*fmt.wrapError)
+         caused by: "EOF" (*errors.errorString)
+ ↳ multi-line: |
+     a
+     b: c
+     caused by: "c" (*errors.errorString)`,
+		},
+		{
+			name: "joined errors",
+			attrs: []slog.Attr{
+				slog.Any("err", errors.Join(
+					fmt.Errorf("save: %w", errors.New("disk full")),
+					errors.Join(errors.New("a"), nil, errors.New("b")),
+					errors.New("c"),
+				)),
+			},
+			want: `23:00:00 INFO msg
+ ↳ err: 3 errors (*errors.joinError)
+     ├─ "save: disk full" (*fmt.wrapError)
+     │  caused by: "disk full" (*errors.errorString)
+     ├─ 2 errors (*errors.joinError)
+     │  ├─ "a" (*errors.errorString)
+     │  └─ "b" (*errors.errorString)
+     └─ "c" (*errors.errorString)`,
+		},
+		{
+			name: "value formatters",
+			opts: &Options{
+				MaxValueLen:   20,
+				ExpandStructs: 1,
+				ValueFormatters: []ValueFormatter{
+					func(v any) (string, bool) {
+						id, ok := v.(testUUID)
+						return fmt.Sprintf("%x-%x", id[:2], id[2:]), ok
+					},
+					func(v any) (string, bool) {
+						u, ok := v.(testUser)
+						return "user " + u.Name, ok
+					},
+				},
+			},
+			attrs: []slog.Attr{
+				slog.Any("id", testUUID{0xde, 0xad, 0xbe, 0xef}),
+				slog.Any("user", testUser{Name: "ann"}),
+				slog.Any("long", testUser{Name: strings.Repeat("x", 20)}),
+				slog.Any("team", testTeam{Name: "core"}),
+			},
+			want: `23:00:00 INFO msg
+ ↳ id: dead-beef
+ ↳ user: user ann
+ ↳ long: user xxxxxxxxxxxxxxx…(25 bytes)
+ ↳ team:
+     ↳ Name: core`,
+		},
+		{
+			name: "drop keys",
+			opts: &Options{DropKeys: []string{"trace_*", "req.headers", "*.internal"}},
+			attrs: []slog.Attr{
+				slog.String("trace_id", "abc"),
+				slog.Group("req",
+					slog.String("path", "/"),
+					slog.Group("headers", slog.String("accept", "*/*")),
+					slog.Bool("internal", true),
+				),
+				slog.Bool("internal", true),
+			},
+			want: `23:00:00 INFO msg
+ ↳ req:
+     ↳ path: /
+ ↳ internal: true`,
+		},
+		{
+			name: "keep keys",
+			opts: &Options{KeepKeys: []string{"user", "req.path", "db"}, DropKeys: []string{"db.password"}},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("trace_id", "abc")})
+			},
+			attrs: []slog.Attr{
+				slog.String("user", "ann"),
+				slog.Group("req",
+					slog.String("path", "/"),
+					slog.String("method", "GET"),
+				),
+				slog.Group("db", slog.String("host", "localhost"), slog.String("password", "x")),
+				slog.Group("other", slog.Int("a", 1)),
+			},
+			want: `23:00:00 INFO msg
+ ↳ user: ann
+ ↳ req:
+     ↳ path: /
+ ↳ db:
+     ↳ host: localhost`,
+		},
+		{
+			name: "redact keys",
+			opts: &Options{RedactKeys: DefaultRedactKeys},
+			attrs: []slog.Attr{
+				slog.String("user", "ann"),
+				slog.String("Password", "hunter2"),
+				slog.Group("req",
+					slog.String("Authorization", "Bearer abc"),
+					slog.String("path", "/"),
+					slog.Group("secrets", slog.String("a", "b")),
+				),
+				slog.String("refresh_token", "xyz"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ user: ann
+ ↳ Password: [REDACTED]
+ ↳ req:
+     ↳ Authorization: [REDACTED]
+     ↳ path: /
+     ↳ secrets: [REDACTED]
+ ↳ refresh_token: [REDACTED]`,
+		},
+		{
+			name: "redact mode hash",
+			opts: &Options{
+				RedactKeys:   []string{"user"},
+				MaskPatterns: DefaultMaskPatterns,
+				RedactMode:   RedactHash,
+			},
+			attrs: []slog.Attr{
+				slog.String("user", "ann"),
+				slog.Group("G", slog.String("user", "ann")),
+				slog.String("to", "ann@example.com"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ user: [sha256:` + sha256Prefix("ann") + `]
+ ↳ G:
+     ↳ user: [sha256:` + sha256Prefix("ann") + `]
+ ↳ to: [sha256:` + sha256Prefix("ann@example.com") + `]`,
+		},
+		{
+			name: "mask patterns",
+			opts: &Options{MaskPatterns: append(DefaultMaskPatterns, MaskPattern{
+				Pattern: regexp.MustCompile(`sk_live_\w+`),
+				Replace: func(match string) string { return match[:8] + "…" },
+			})},
+			attrs: []slog.Attr{
+				slog.String("card", "paid with 4111 1111 1111 1111 today"),
+				slog.String("auth", "Bearer eyJhbGciOi.J9.x-y_z"),
+				slog.String("to", "ann@example.com, bob@example.org"),
+				slog.String("key", "sk_live_abc123"),
+				slog.Int("n", 4111111111111111),
+				slog.String("order", "1234"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ card: paid with [REDACTED] today
+ ↳ auth: [REDACTED]
+ ↳ to: [REDACTED], [REDACTED]
+ ↳ key: sk_live_…
+ ↳ n: 4111111111111111
+ ↳ order: 1234`,
+		},
+		{
+			name: "key formats",
+			opts: &Options{
+				KeyFormats: []KeyFormat{
+					{Key: "status", Format: func(v slog.Value) (string, Color) {
+						return v.String() + " " + http.StatusText(int(v.Int64())), ""
+					}},
+					{Key: "*_ms", Format: func(v slog.Value) (string, Color) {
+						return (time.Duration(v.Int64()) * time.Millisecond).String(), ""
+					}},
+					{Key: "status", Format: func(v slog.Value) (string, Color) {
+						return "unused", ""
+					}},
+				},
+				ValueFormatters: []ValueFormatter{func(v any) (string, bool) { return "by type", true }},
+			},
+			attrs: []slog.Attr{
+				slog.Int("status", 404),
+				slog.Group("G", slog.Int64("latency_ms", 1500)),
+				slog.Any("other", struct{}{}),
+			},
+			want: `23:00:00 INFO msg
+ ↳ status: 404 Not Found
+ ↳ G:
+     ↳ latency_ms: 1.5s
+ ↳ other: by type`,
+		},
+		{
+			name: "expand structs",
+			opts: &Options{ExpandStructs: 2},
+			attrs: []slog.Attr{
+				slog.Any("req", &testRequest{
+					Method:  "GET",
+					Headers: map[string]string{"b": "2", "a": "1"},
+					User:    &testUser{Name: "ann", Team: testTeam{Name: "core"}},
+					Err:     errors.New("boom"),
+					private: true,
+				}),
+				slog.Any("empty", struct{}{}),
+				slog.Any("nil", (*testUser)(nil)),
+			},
+			want: `23:00:00 INFO msg
+ ↳ req:
+     ↳ Method: GET
+     ↳ Headers:
+         ↳ a: 1
+         ↳ b: 2
+     ↳ User:
+         ↳ Name: ann
+         ↳ Team: {Name:core}
+     ↳ Err: "boom" (*errors.errorString)
+ ↳ empty: {}
+ ↳ nil: <nil>`,
+		},
+		{
+			name: "expand maps sorted by key",
+			opts: &Options{ExpandStructs: 1},
+			attrs: []slog.Attr{
+				slog.Any("ints", map[int]string{10: "ten", 2: "two", -1: "minus one"}),
+				slog.Any("mixed", map[any]int{"b": 1, 3: 2, "a": 3, int8(3): 4, nil: 5}),
+				slog.Any("nan", map[float64]int{math.NaN(): 1}),
+			},
+			want: `23:00:00 INFO msg
+ ↳ ints:
+     ↳ -1: minus one
+     ↳ 2: two
+     ↳ 10: ten
+ ↳ mixed:
+     ↳ 3: 2
+     ↳ 3: 4
+     ↳ <nil>: 5
+     ↳ a: 3
+     ↳ b: 1
+ ↳ nan:
+     ↳ NaN: 1`,
+		},
+		{
+			name: "slice min len",
+			opts: &Options{SliceMinLen: 2},
+			attrs: []slog.Attr{
+				slog.Any("ids", []int{7, 42}),
+				slog.Any("errs", []error{errors.New("a"), errors.New("b")}),
+				slog.Any("one", []string{"x"}),
+				slog.Any("nested", [][]string{{"a", "b"}, {"c"}}),
+				slog.Any("bytes", []byte("hi")),
+			},
+			want: `23:00:00 INFO msg
+ ↳ ids:
+     ↳ 0: 7
+     ↳ 1: 42
+ ↳ errs:
+     ↳ 0: "a" (*errors.errorString)
+     ↳ 1: "b" (*errors.errorString)
+ ↳ one: [x]
+ ↳ nested:
+     ↳ 0:
+         ↳ 0: a
+         ↳ 1: b
+     ↳ 1: [c]
+ ↳ bytes: 6869`,
+		},
+		{
+			name: "bytes base64 and hex dump max len",
+			opts: &Options{Base64Bytes: true, HexDumpMaxLen: 16},
+			attrs: []slog.Attr{
+				slog.Any("short", []byte("hello")),
+				slog.Any("long", []byte("hello, world! hello, world!")),
+			},
+			want: `23:00:00 INFO msg
+ ↳ short: aGVsbG8=
+ ↳ long: (27 bytes)
+     00000000  68 65 6c 6c 6f 2c 20 77  6f 72 6c 64 21 20 68 65  |hello, world! he|
+     … (11 more bytes)`,
+		},
+		{
+			name: "key prefix",
+			opts: &Options{KeyPrefix: "app."},
+			attrs: []slog.Attr{
+				slog.String("app.a", "b"),
+				slog.String("c", "d"),
+				slog.String("app.", "e"),
+				slog.Group("app.G", slog.String("app.f", "g")),
+			},
+			want: `keys are shown without the prefix app.
+23:00:00 INFO msg
+ ↳ a: b
+ ↳ c: d
+ ↳ app.: e
+ ↳ G:
+     ↳ f: g`,
+		},
+		{
+			name: "dedupe keys",
+			opts: &Options{DedupeKeys: true},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("a", "1"), slog.String("b", "1")}).
+					WithGroup("G").WithAttrs([]slog.Attr{slog.String("a", "2")})
+			},
+			attrs: []slog.Attr{
+				slog.String("a", "3"),
+				slog.Group("H", slog.String("c", "1"), slog.String("c", "2")),
+				slog.Group("H", slog.String("d", "1")),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: 1
+ ↳ b: 1
+ ↳ G:
+     ↳ a: 3
+     ↳ H:
+         ↳ d: 1`,
+		},
+		{
+			name: "duration bars",
+			opts: &Options{DurationBarMax: time.Second, ColorDepth: ColorDepth16},
+			attrs: []slog.Attr{
+				slog.Duration("a", 0),
+				slog.Duration("b", 250*time.Millisecond),
+				slog.Duration("c", 2*time.Second),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: 0s ··········
+ ↳ b: 250ms ██▌·······
+ ↳ c: 2s ██████████`,
+		},
+		{
+			name:  "no duration bars without colors",
+			opts:  &Options{DurationBarMax: time.Second, NoColor: true},
+			attrs: []slog.Attr{slog.Duration("a", time.Second)},
+			want: `23:00:00 INFO msg
+ ↳ a: 1s`,
+		},
+		{
+			name: "panic in LogValue",
+			attrs: []slog.Attr{
+				slog.Any("a", panickyValuer{}),
+				slog.String("b", "c"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: <PANIC in LogValue: oops>
+ ↳ b: c`,
+		},
+		{
+			name:  "show date",
+			opts:  &Options{ShowDate: true},
+			attrs: []slog.Attr{slog.Time("foo", now)},
+			want: `2009-11-09T23:00:00 INFO msg
+ ↳ foo: 2009-11-09T23:00:00`,
+		},
+		{
+			name: "attr count",
+			opts: &Options{AttrCount: true},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("a", "b")}).WithGroup("G")
+			},
+			attrs: []slog.Attr{slog.Group("H", slog.Int("c", 1), slog.Int("d", 2)), slog.Group("I")},
+			want: `23:00:00 INFO msg [3 attrs]
+ ↳ a: b
+ ↳ G:
+     ↳ H:
+         ↳ c: 1
+         ↳ d: 2`,
+		},
+		{
+			name: "attr count without attributes",
+			opts: &Options{AttrCount: true},
+			want: `23:00:00 INFO msg`,
+		},
+		{
+			name:  "time locale",
+			opts:  &Options{TimeLocale: "en_US.UTF-8"},
+			attrs: []slog.Attr{slog.Time("foo", now)},
+			want: "11:00:00\u202fPM INFO msg\n" +
+				" ↳ foo: 11:00:00\u202fPM",
+		},
+		{
+			name:  "time locale with date",
+			opts:  &Options{TimeLocale: "de", ShowDate: true},
+			attrs: []slog.Attr{slog.Time("foo", now)},
+			want: "09.11.2009\u00a023:00:00 INFO msg\n" +
+				" ↳ foo: 09.11.2009\u00a023:00:00",
+		},
+		{
+			name:  "time format",
+			opts:  &Options{TimeFormat: time.Kitchen, TimeLocale: "de"},
+			attrs: []slog.Attr{slog.Time("foo", now)},
+			want: `11:00PM INFO msg
+ ↳ foo: 11:00PM`,
+		},
+		{
+			name: "time formatter",
+			opts: &Options{
+				TimeFormat: time.Kitchen,
+				TimeFormatter: func(t time.Time) string {
+					return strconv.FormatInt(t.Unix(), 10)
+				},
+			},
+			attrs: []slog.Attr{slog.Time("foo", now)},
+			want: `1257807600 INFO msg
+ ↳ foo: 1257807600`,
+		},
+		{
+			name:  "time zone",
+			opts:  &Options{TimeZone: time.FixedZone("CET", 3600), ShowTimeZone: true},
+			attrs: []slog.Attr{slog.Time("foo", now.In(time.FixedZone("EST", -5*3600)))},
+			want: "00:00:00\u00a0CET INFO msg\n" +
+				" ↳ foo: 00:00:00\u00a0CET",
+		},
+		{
+			name:  "time zone of the record",
+			opts:  &Options{ShowTimeZone: true},
+			attrs: []slog.Attr{slog.Time("foo", now.In(time.FixedZone("EST", -5*3600)))},
+			want: "23:00:00\u00a0UTC INFO msg\n" +
+				" ↳ foo: 18:00:00\u00a0EST",
+		},
+		{
+			name: "elapsed",
+			opts: &Options{Elapsed: true, ElapsedStart: now.Add(-1500 * time.Millisecond)},
+			want: `23:00:00 T+1.5s INFO msg`,
+		},
+		{
+			name: "elapsed instead of time",
+			opts: &Options{
+				Elapsed:      true,
+				ElapsedStart: now.Add(-12345 * time.Microsecond),
+				HeaderOrder:  []HeaderField{HeaderElapsed, HeaderLevel, HeaderMessage},
+			},
+			want: `T+12.345ms INFO msg`,
+		},
+		{
+			name:  "time precision",
+			opts:  &Options{TimePrecision: 3},
+			attrs: []slog.Attr{slog.Time("foo", now.Add(1234567*time.Nanosecond))},
+			want: `23:00:00.000 INFO msg
+ ↳ foo: 23:00:00.001`,
+		},
+		{
+			name: "time precision with locale",
+			opts: &Options{TimePrecision: 6, TimeLocale: "en-US", ShowDate: true},
+			want: "11/09/2009\u00a011:00:00.000000\u202fPM INFO msg",
+		},
+		{
+			name: "unknown time locale",
+			opts: &Options{TimeLocale: "xx-XX"},
+			want: `23:00:00 INFO msg`,
+		},
+		{
+			name: "wrap",
+			opts: &Options{Wrap: true, Width: 20},
+			attrs: []slog.Attr{
+				slog.String("foo", "the quick brown fox jumps over"),
+				slog.String("bar", "0123456789abcdefghijklmnop"),
+				slog.String("baz", "short"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ foo: the quick
+     brown fox jumps
+     over
+ ↳ bar: 0123456789ab
+     cdefghijklmnop
+ ↳ baz: short`,
+		},
+		{
+			name: "multi-line values",
+			opts: &Options{Wrap: true, Width: 20},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithGroup("G")
+			},
+			attrs: []slog.Attr{
+				slog.String("a", "first line\n  indented second line\n"),
+				slog.Any("err", errors.New("failed:\nno space")),
+			},
+			want: `23:00:00 INFO msg
+ ↳ G:
+     ↳ a: |
+         first line
+           indented
+         second line
+     ↳ err: |
+         failed:
+         no space`,
+		},
+		{
+			name: "pretty json",
+			opts: &Options{PrettyJSON: true, MaxValueLen: 30},
+			attrs: []slog.Attr{
+				slog.String("a", `{"b": [1, true], "c": {}}`),
+				slog.Any("raw", json.RawMessage(`[null]`)),
+				slog.String("long", `{"b": "this is longer than the limit"}`),
+				slog.String("invalid", `{"b"}`),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: |
+     {
+       "b": [
+         1,
+         true
+       ],
+       "c": {}
+     }
+ ↳ raw: |
+     [
+       null
+     ]
+ ↳ long: {"b": "this is longer than the…(38 bytes)
+ ↳ invalid: {"b"}`,
+		},
+		{
+			name: "sql",
+			opts: &Options{SQLKeys: []string{"query", "one"}},
+			attrs: []slog.Attr{
+				slog.String("query", "select id from users u\n left outer join orders o on o.user_id = u.id -- why\n"+
+					"where name = 'select' and (total > 10 or total is null) and id in (select id from x) order by id"),
+				slog.String("one", "SELECT  1"),
+				slog.String("other", "SELECT 1 FROM t"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ query: |
+     select id
+     from users u
+     left outer join orders o on o.user_id = u.id -- why
+     where name = 'select'
+       and (total > 10 or total is null)
+       and id in (select id from x)
+     order by id
+ ↳ one: SELECT 1
+ ↳ other: SELECT 1 FROM t`,
+		},
+		{
+			name: "byte sizes",
+			opts: &Options{ByteSizeKeys: []string{"size", "*_bytes"}, ThousandsSeparator: ","},
+			attrs: []slog.Attr{
+				slog.Int("size", 512),
+				slog.Int64("body_bytes", 1468006),
+				slog.Uint64("disk_bytes", 327680),
+				slog.Int("delta_bytes", -2048),
+				slog.Int("count", 1468006),
+				slog.String("resp_bytes", "n/a"),
+			},
+			want: `23:00:00 INFO msg
+ ↳ size: 512 B
+ ↳ body_bytes: 1.4 MiB (1,468,006)
+ ↳ disk_bytes: 320 KiB (327,680)
+ ↳ delta_bytes: -2 KiB (-2,048)
+ ↳ count: 1,468,006
+ ↳ resp_bytes: n/a`,
+		},
+		{
+			name: "durations",
+			attrs: []slog.Attr{
+				slog.Duration("a", 850*time.Nanosecond),
+				slog.Duration("b", 3456789*time.Nanosecond),
+				slog.Duration("c", 34567890*time.Nanosecond),
+				slog.Duration("d", 340567890*time.Nanosecond),
+				slog.Duration("e", -1234567890*time.Nanosecond),
+				slog.Duration("f", 4*time.Minute+12345*time.Millisecond),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: 850ns
+ ↳ b: 3.46ms
+ ↳ c: 34.6ms
+ ↳ d: 341ms
+ ↳ e: -1.23s
+ ↳ f: 4m12s`,
+		},
+		{
+			name: "duration unit",
+			opts: &Options{DurationUnit: time.Millisecond, FloatPrecision: 1},
+			attrs: []slog.Attr{
+				slog.Duration("a", 850*time.Microsecond),
+				slog.Duration("b", 4*time.Minute),
+			},
+			want: `23:00:00 INFO msg
+ ↳ a: 0.8ms
+ ↳ b: 240000.0ms`,
+		},
+		{
+			name:  "github actions fold markers",
+			opts:  &Options{FoldStyle: FoldGitHubActions},
+			attrs: []slog.Attr{slog.String("a", "b"), slog.String("c", "d")},
+			want: `::group::23:00:00 INFO msg
+ ↳ a: b
+ ↳ c: d
+::endgroup::`,
+		},
+		{
+			name:  "vim fold markers",
+			opts:  &Options{FoldStyle: FoldVim},
+			attrs: []slog.Attr{slog.String("a", "b")},
+			want: `23:00:00 INFO msg {{{
+ ↳ a: b }}}`,
+		},
+		{
+			name: "no fold markers for a single line",
+			opts: &Options{FoldStyle: FoldVim},
+			want: `23:00:00 INFO msg`,
+		},
+		{
+			name:  "header order",
+			opts:  &Options{HeaderOrder: []HeaderField{HeaderLevel, HeaderMessage, HeaderTime}},
+			attrs: []slog.Attr{slog.String("a", "b")},
+			want: `INFO msg 23:00:00
+ ↳ a: b`,
+		},
+		{
+			name:  "frame",
+			opts:  &Options{Frame: true, FrameEnd: "--"},
+			attrs: []slog.Attr{slog.String("a", "b")},
+			want: `┌──
+23:00:00 INFO msg
+ ↳ a: b
+--`,
+		},
+		{
+			name:  "custom level name",
+			opts:  &Options{LevelNames: map[slog.Level]string{slog.Level(-8): "TRACE"}},
+			level: slog.Level(-8),
+			want:  `23:00:00 TRACE msg`,
+		},
+		{
+			name:  "level without a custom name",
+			opts:  &Options{LevelNames: map[slog.Level]string{slog.Level(-8): "TRACE"}},
+			level: slog.Level(10),
+			want:  `23:00:00 ERROR+2 msg`,
+		},
+		{
+			name:  "sidebar",
+			opts:  &Options{SidebarKeys: []string{"trace", "req"}, SidebarWidth: 16, Width: 40},
+			attrs: []slog.Attr{slog.String("req", "r1"), slog.String("a", "b"), slog.String("trace", "t1")},
+			want: `23:00:00 INFO msg        trace=t1 req=r1
+ ↳ a: b`,
+		},
+		{
+			name: "sidebar keeps attributes in groups",
+			opts: &Options{SidebarKeys: []string{"trace", "req"}, SidebarWidth: 16, Width: 40},
+			with: func(h slog.Handler) slog.Handler {
+				return h.WithAttrs([]slog.Attr{slog.String("req", "r1")}).WithGroup("G").WithAttrs([]slog.Attr{slog.String("trace", "t1")})
+			},
+			attrs: []slog.Attr{slog.String("req", "r2")},
+			want: `23:00:00 INFO msg                 req=r1
+ ↳ G:
+     ↳ trace: t1
+     ↳ req: r2`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			level := slog.LevelInfo
+			if tc.level != nil {
+				level = tc.level.Level()
+			}
+			rec := slog.NewRecord(now, level, "msg", 0)
+			rec.AddAttrs(tc.attrs...)
+			var buf bytes.Buffer
+
+			var h slog.Handler = New(&buf, tc.opts)
+			if tc.with != nil {
+				h = tc.with(h)
+			}
+
+			err := h.Handle(t.Context(), rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := stripANSI(buf.String())
+			got = strings.TrimSuffix(got, "\n") // discard new line so that writing expected values is easier.
+
+			if got != tc.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTimeDelta(t *testing.T) {
+	now := time.Date(2009, time.November, 9, 23, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{0, 50 * time.Millisecond, 300 * time.Millisecond, 1500 * time.Millisecond}
+
+	testCases := []struct {
+		name   string
+		opts   *Options
+		levels []slog.Level
+		want   string
+	}{
+		{
+			name: "every delta",
+			opts: &Options{TimeDelta: true},
+			want: "23:00:00 INFO msg\n+50ms INFO msg\n+250ms INFO msg\n+1.2s INFO msg\n",
+		},
+		{
+			name: "threshold",
+			opts: &Options{TimeDelta: true, TimeDeltaThreshold: 100 * time.Millisecond},
+			want: "23:00:00 INFO msg\nINFO msg\n+250ms INFO msg\n+1.2s INFO msg\n",
+		},
+		{
+			name: "hover",
+			opts: &Options{TimeDelta: true, TimeHover: true},
+			want: "23:00:00 INFO msg\n" +
+				"\033]8;;time:2009-11-09T23:00:00.05Z\033\\+50ms\033]8;;\033\\ INFO msg\n" +
+				"\033]8;;time:2009-11-09T23:00:00.3Z\033\\+250ms\033]8;;\033\\ INFO msg\n" +
+				"\033]8;;time:2009-11-09T23:00:01.5Z\033\\+1.2s\033]8;;\033\\ INFO msg\n",
+		},
+		{
+			name: "interval",
+			opts: &Options{TimeDelta: true, TimeDeltaInterval: time.Second},
+			want: "23:00:00 INFO msg\n+50ms INFO msg\n+250ms INFO msg\n23:00:01 INFO msg\n",
+		},
+		{
+			name:   "level",
+			opts:   &Options{TimeDelta: true, TimeDeltaLevel: slog.LevelWarn},
+			levels: []slog.Level{slog.LevelInfo, slog.LevelWarn, slog.LevelInfo, slog.LevelError},
+			want:   "23:00:00 INFO msg\n23:00:00 WARN msg\n+250ms INFO msg\n23:00:01 ERROR msg\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := New(&buf, tc.opts)
+			h.hyperlinks = tc.opts.TimeHover // a bytes.Buffer is not a terminal.
+
+			for i, offset := range offsets {
+				level := slog.LevelInfo
+				if tc.levels != nil {
+					level = tc.levels[i]
+				}
+				err := h.Handle(t.Context(), slog.NewRecord(now.Add(offset), level, "msg", 0))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := buf.String()
+			for _, level := range []slog.Level{slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+				got = strings.ReplaceAll(got, h.levelText(level), level.String())
+			}
+			if got != tc.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWrapFollowsWidth(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{NoColor: true, Wrap: true, Width: 20, HeaderOrder: []HeaderField{HeaderMessage}})
+	logger := slog.New(h).With("a", "b")
+
+	logger.Info("msg", "foo", "the quick brown fox")
+	// This is what happens when the terminal of the output is resized.
+	h.state.width.Store(40)
+	logger.Info("msg", "foo", "the quick brown fox")
+
+	want := "msg\n ↳ a: b\n ↳ foo: the quick\n     brown fox\nmsg\n ↳ a: b\n ↳ foo: the quick brown fox\n"
+	if buf.String() != want {
+		t.Errorf("\ngot:  %q\nwant: %q", buf.String(), want)
+	}
+}
+
+func TestWrapNarrowerThanIndent(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{NoColor: true, Wrap: true, Width: 1, HeaderOrder: []HeaderField{HeaderMessage}})
+	slog.New(h).WithGroup("g").Info("msg", "foo", "ab")
+
+	want := "msg\n ↳ g:\n     ↳ foo: \n         a\n         b\n"
+	if buf.String() != want {
+		t.Errorf("\ngot:  %q\nwant: %q", buf.String(), want)
+	}
+}
+
+func TestDateBanner(t *testing.T) {
+	now := time.Date(2009, time.November, 9, 23, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	h := New(&buf, &Options{NoColor: true, DateBanner: true})
+	for _, offset := range []time.Duration{0, 30 * time.Minute, 90 * time.Minute, 2 * time.Hour} {
+		if err := h.Handle(t.Context(), slog.NewRecord(now.Add(offset), slog.LevelInfo, "msg", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "23:00:00 INFO msg\n23:30:00 INFO msg\n── 2009-11-10 ──\n00:30:00 INFO msg\n01:00:00 INFO msg\n"
+	if buf.String() != want {
+		t.Errorf("\ngot:  %q\nwant: %q", buf.String(), want)
+	}
+}
+
+func TestASCIIRules(t *testing.T) {
+	now := time.Date(2009, time.November, 9, 23, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	h := New(&buf, &Options{NoColor: true, ASCII: true, DateBanner: true, HeaderOrder: []HeaderField{HeaderMessage}})
+	for _, offset := range []time.Duration{0, 2 * time.Hour} {
+		if err := h.Handle(t.Context(), slog.NewRecord(now.Add(offset), slog.LevelInfo, "msg", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := h.Batch("request")
+	if err := b.Handle(t.Context(), slog.NewRecord(now.Add(2*time.Hour), slog.LevelInfo, "batched", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "msg\n-- 2009-11-10 --\nmsg\n" +
+		"-- request " + strings.Repeat("-", 29) + "\nbatched\n" + strings.Repeat("-", 40) + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+// closeRecorder is a writer that records whether it was closed.
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestFlushAndClose(t *testing.T) {
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+
+	t.Run("flush", func(t *testing.T) {
+		var out bytes.Buffer
+		h := New(bufio.NewWriter(&out), nil)
+		if err := h.Handle(t.Context(), rec); err != nil {
+			t.Fatal(err)
+		}
+		if out.Len() != 0 {
+			t.Fatalf("expected output to be buffered, got %q", out.String())
+		}
+
+		if err := h.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if got := stripANSI(out.String()); got != "INFO msg\n" {
+			t.Errorf("wrong output after Flush; got %q", got)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		w := &closeRecorder{}
+		h := New(w, nil).WithGroup("G").(*Handler)
+		if err := h.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !w.closed {
+			t.Error("expected writer to be closed")
+		}
+	})
+
+	t.Run("no-op", func(t *testing.T) {
+		h := New(&bytes.Buffer{}, nil)
+		if err := h.Flush(); err != nil {
+			t.Error(err)
+		}
+		if err := h.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestAsync(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{AsyncBuffer: 16, NoColor: true})
+
+	const goroutines, records = 8, 100
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range records {
+				rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+				rec.AddAttrs(slog.Int("g", g), slog.Int("i", i))
+				if err := h.Handle(t.Context(), rec); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each record must be written in one piece, and the records of a
+	// goroutine in the order they were handled.
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != goroutines*records*3 {
+		t.Fatalf("wrong number of lines; got %d", len(lines))
+	}
+	next := make(map[string]int)
+	for i := 0; i < len(lines); i += 3 {
+		g, ok1 := strings.CutPrefix(lines[i+1], " ↳ g: ")
+		n, ok2 := strings.CutPrefix(lines[i+2], " ↳ i: ")
+		if lines[i] != "INFO msg" || !ok1 || !ok2 {
+			t.Fatalf("interleaved record at line %d: %q", i, lines[i:i+3])
+		}
+		if n != strconv.Itoa(next[g]) {
+			t.Fatalf("record %s of goroutine %s is out of order", n, g)
+		}
+		next[g]++
+	}
+
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	if err := h.Handle(t.Context(), rec); err != errClosed {
+		t.Errorf("expected errClosed after Close, got %v", err)
+	}
+}
+
+func BenchmarkHandle(b *testing.B) {
+	h := New(io.Discard, nil)
+	rec := slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0)
+	for i := range 5 {
+		rec.AddAttrs(slog.String("s"+strconv.Itoa(i), "value"), slog.Int("i"+strconv.Itoa(i), i*1000))
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = h.Handle(context.Background(), rec)
+	}
+}
+
+func BenchmarkHandleParallel(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts *Options
+	}{
+		{name: "sync", opts: &Options{}},
+		{name: "async", opts: &Options{AsyncBuffer: 1024}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			h := New(io.Discard, bc.opts)
+			rec := slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0)
+			rec.AddAttrs(slog.String("foo", "bar"), slog.Int("n", 42))
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = h.Handle(context.Background(), rec)
+				}
+			})
+			if err := h.Close(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	now := time.Date(2009, time.November, 9, 23, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	h := New(&buf,
+		&Options{AttrCount: true},
+		WithLevel(slog.LevelWarn),
+		WithTimeFormat(time.Kitchen),
+		WithColor(false),
+	)
+	for _, level := range []slog.Level{slog.LevelInfo, slog.LevelWarn} {
+		if h.Enabled(t.Context(), level) {
+			if err := h.Handle(t.Context(), slog.NewRecord(now, level, "msg", 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if got, want := buf.String(), "11:00PM WARN msg\n"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	if !h.opts.AttrCount {
+		t.Error("expected the options of *Options to be kept")
+	}
+}
+
+func TestSetWriter(t *testing.T) {
+	var first, second bytes.Buffer
+	h := New(&first, &Options{NoColor: true})
+	derived := h.WithGroup("G").(*Handler)
+
+	h.SetWriter(&second)
+	if derived.Writer() != &second {
+		t.Error("expected the writer of derived handlers to be replaced")
+	}
+
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	if err := derived.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+	if first.Len() != 0 {
+		t.Errorf("expected no output to the previous writer, got %q", first.String())
+	}
+	if got := second.String(); got != "INFO msg\n" {
+		t.Errorf("wrong output to the new writer; got %q", got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{NoColor: true, HeaderOrder: []HeaderField{HeaderLevel, HeaderMessage}})
+
+	b := h.Batch("request")
+	logger := slog.New(b).With("id", 1)
+	logger.Info("start")
+	slog.New(h).Info("other")
+	logger.WithGroup("G").Info("end", "status", 200)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Handle(t.Context(), slog.NewRecord(time.Time{}, slog.LevelInfo, "late", 0)); err != errBatchClosed {
+		t.Errorf("expected errBatchClosed after Close, got %v", err)
+	}
+
+	// A batch that isn't closed is written when the handler is.
+	slog.New(h.Batch("")).Info("forgotten")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	want := `INFO other
+── request ─────────────────────────────
+INFO start
+ ↳ id: 1
+INFO end
+ ↳ id: 1
+ ↳ G:
+     ↳ status: 200
+────────────────────────────────────────
+INFO forgotten
+`
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestLegend(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{Legend: true, AttrCount: true, NoColor: true})
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	for range 2 {
+		if err := h.Handle(t.Context(), rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "legend:\n" +
+		"  DEBUG INFO WARN ERROR   levels\n" +
+		"  ↳ key: value            an attribute of the record\n" +
+		"  [3 attrs]               the number of attributes of the record\n" +
+		"INFO msg\n" +
+		"INFO msg\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestContextExtractors(t *testing.T) {
+	type ctxKey struct{}
+
+	var buf bytes.Buffer
+	h := New(&buf, &Options{
+		ContextExtractors: []ContextExtractor{
+			func(ctx context.Context) []slog.Attr {
+				if id, ok := ctx.Value(ctxKey{}).(string); ok {
+					return []slog.Attr{slog.String("trace", id)}
+				}
+				return nil
+			},
+			func(context.Context) []slog.Attr { return nil },
+		},
+	}).WithGroup("G")
+
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(slog.String("a", "b"))
+
+	ctx := context.WithValue(t.Context(), ctxKey{}, "t1")
+	if err := h.Handle(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "INFO msg\n ↳ G:\n     ↳ a: b\n     ↳ trace: t1\nINFO msg\n ↳ G:\n     ↳ a: b\n"
+	if got := stripANSI(buf.String()); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	h := New(io.Discard, &Options{
+		ColorDepth:  ColorDepth16,
+		Theme:       ThemeDark,
+		LevelNames:  map[slog.Level]string{slog.Level(12): "FATAL"},
+		LevelColors: map[slog.Level]Color{slog.Level(12): Magenta, slog.LevelInfo: Green},
+	})
+
+	testCases := []struct {
+		level slog.Level
+		want  string
+	}{
+		{level: slog.Level(12), want: "\033[35mFATAL\033[0m"},
+		{level: slog.LevelInfo, want: "\033[32mINFO\033[0m"},
+		{level: slog.LevelError, want: "\033[31mERROR\033[0m"},
+		{level: slog.LevelInfo + 2, want: "\033[32mINFO+2\033[0m"},
+		{level: slog.LevelWarn + 1, want: "\033[33mWARN+1\033[0m"},
+		{level: slog.Level(16), want: "\033[35mERROR+8\033[0m"},
+		{level: LevelTrace, want: "\033[2mTRACE\033[0m"},
+	}
+
+	for _, tc := range testCases {
+		if got := h.levelText(tc.level); got != tc.want {
+			t.Errorf("level %d; got %q, want %q", tc.level, got, tc.want)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	h := New(io.Discard, &Options{
+		LevelNames: map[slog.Level]string{slog.Level(-8): "TRACE", slog.Level(12): "FATAL"},
+	})
+
+	testCases := []struct {
+		name    string
+		want    slog.Level
+		wantErr bool
+	}{
+		{name: "trace", want: slog.Level(-8)},
+		{name: "FATAL", want: slog.Level(12)},
+		{name: "warn", want: slog.LevelWarn},
+		{name: "ERROR+2", want: slog.LevelError + 2},
+		{name: "loud", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := h.ParseLevel(tc.name)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: unexpected error %v", tc.name, err)
+		}
+		if err == nil && got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	var pcs [1]uintptr
+	runtime.Callers(1, pcs[:])
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	dir, file := filepath.Split(frame.File)
+	loc := filepath.Base(dir) + "/" + file + ":" + strconv.Itoa(frame.Line)
+
+	testCases := []struct {
+		name       string
+		opts       *Options
+		hyperlinks bool
+		want       string
+	}{
+		{
+			name: "plain",
+			opts: &Options{HandlerOptions: slog.HandlerOptions{AddSource: true}, NoColor: true},
+			want: "INFO " + loc + " msg\n",
+		},
+		{
+			name: "function",
+			opts: &Options{HandlerOptions: slog.HandlerOptions{AddSource: true}, NoColor: true, SourceFunc: true},
+			want: "INFO devslog.TestSource@" + loc + " msg\n",
+		},
+		{
+			name:       "link",
+			opts:       &Options{HandlerOptions: slog.HandlerOptions{AddSource: true}, NoColor: true, SourceLinks: true, SourceURLTemplate: "vscode://file/%s:%d"},
+			hyperlinks: true,
+			want:       "INFO \033]8;;vscode://file/" + frame.File + ":" + strconv.Itoa(frame.Line) + "\033\\" + loc + "\033]8;;\033\\ msg\n",
+		},
+		{
+			name: "unsupported link",
+			opts: &Options{HandlerOptions: slog.HandlerOptions{AddSource: true}, NoColor: true, SourceLinks: true},
+			want: "INFO " + loc + " msg\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := New(&buf, tc.opts)
+			h.hyperlinks = tc.hyperlinks
+
+			if err := h.Handle(t.Context(), slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", pcs[0])); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestURLLinks(t *testing.T) {
+	u, _ := url.Parse("https://example.com/a?b=c")
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(
+		slog.String("a", "http://example.com"),
+		slog.Any("b", u),
+		slog.String("c", "see http://example.com"),
+		slog.String("d", "ftp://example.com"),
+	)
+
+	var buf bytes.Buffer
+	h := New(&buf, &Options{URLLinks: true, ColorDepth: ColorDepth16, HeaderOrder: []HeaderField{HeaderMessage}})
+	h.hyperlinks = true // a bytes.Buffer is not a terminal.
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	got := stripANSI(buf.String())
+	for _, want := range []string{
+		"\033]8;;http://example.com\033\\\033[4mhttp://example.com\033[0m\033]8;;\033\\",
+		"\033]8;;https://example.com/a?b=c\033\\\033[4mhttps://example.com/a?b=c\033[0m\033]8;;\033\\",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q\noutput: %q", want, buf.String())
+		}
+	}
+	if want := "msg\n ↳ a: http://example.com\n ↳ b: https://example.com/a?b=c\n ↳ c: see http://example.com\n ↳ d: ftp://example.com\n"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestGroupLevels(t *testing.T) {
+	h := New(io.Discard, &Options{
+		HandlerOptions: slog.HandlerOptions{Level: slog.LevelWarn},
+		GroupLevels: map[string]slog.Leveler{
+			"db":      slog.LevelDebug,
+			"db.pool": slog.LevelError,
+		},
+	})
+
+	testCases := []struct {
+		groups []string
+		want   slog.Level
+	}{
+		{groups: nil, want: slog.LevelWarn},
+		{groups: []string{"http"}, want: slog.LevelWarn},
+		{groups: []string{"db"}, want: slog.LevelDebug},
+		{groups: []string{"db", "query"}, want: slog.LevelDebug},
+		{groups: []string{"db", "pool"}, want: slog.LevelError},
+		{groups: []string{"http", "db"}, want: slog.LevelWarn},
+		{groups: []string{"dbx"}, want: slog.LevelWarn},
+	}
+	for _, tc := range testCases {
+		var sh slog.Handler = h
+		for _, g := range tc.groups {
+			sh = sh.WithGroup(g)
+		}
+		if !sh.Enabled(t.Context(), tc.want) || sh.Enabled(t.Context(), tc.want-1) {
+			t.Errorf("groups %v: expected the minimum level %v", tc.groups, tc.want)
+		}
+	}
+}
+
+func TestParseLevelDirectives(t *testing.T) {
+	opt, err := ParseLevelDirectives("warn, db=debug,http.client = error,,jobs=trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(io.Discard, &Options{ComponentKey: "component"}, opt)
+
+	testCases := []struct {
+		handler slog.Handler
+		want    slog.Level
+	}{
+		{handler: h, want: slog.LevelWarn},
+		{handler: h.WithGroup("db"), want: slog.LevelDebug},
+		{handler: h.WithGroup("http").WithGroup("client"), want: slog.LevelError},
+		{handler: h.WithGroup("http"), want: slog.LevelWarn},
+		{handler: h.WithAttrs([]slog.Attr{slog.String("component", "jobs")}), want: LevelTrace},
+		{handler: h.WithAttrs([]slog.Attr{slog.String("component", "http.client.pool")}), want: slog.LevelError},
+		// The component takes precedence over groups.
+		{handler: h.WithAttrs([]slog.Attr{slog.String("component", "api")}).WithGroup("db"), want: slog.LevelWarn},
+	}
+	for i, tc := range testCases {
+		if !tc.handler.Enabled(t.Context(), tc.want) || tc.handler.Enabled(t.Context(), tc.want-1) {
+			t.Errorf("%d: expected the minimum level %v", i, tc.want)
+		}
+	}
+
+	for _, directives := range []string{"db=", "=debug", "loud", "db=loud"} {
+		if _, err := ParseLevelDirectives(directives); err == nil {
+			t.Errorf("%q: expected an error", directives)
+		}
+	}
+}
+
+func TestLevelEnv(t *testing.T) {
+	t.Setenv("TEST_LEVEL", "error,db=debug")
+	h := New(io.Discard, &Options{
+		LevelEnv:    "TEST_LEVEL",
+		GroupLevels: map[string]slog.Leveler{"http": slog.LevelWarn},
+	})
+	if h.Enabled(t.Context(), slog.LevelWarn) {
+		t.Error("expected the level of the environment")
+	}
+	if !h.WithGroup("db").Enabled(t.Context(), slog.LevelDebug) {
+		t.Error("expected the level of db from the environment")
+	}
+	if !h.WithGroup("http").Enabled(t.Context(), slog.LevelWarn) || h.WithGroup("http").Enabled(t.Context(), slog.LevelInfo) {
+		t.Error("expected the level of http from the options")
+	}
+
+	t.Setenv("TEST_LEVEL", "db=loud")
+	if h := New(io.Discard, &Options{LevelEnv: "TEST_LEVEL"}); !h.Enabled(t.Context(), slog.LevelInfo) {
+		t.Error("expected invalid directives to be ignored")
+	}
+}
+
+func TestNewHandlerFromEnv(t *testing.T) {
+	t.Setenv(EnvLevel, "debug")
+	t.Setenv(EnvColor, "always")
+	t.Setenv(EnvTimeFormat, "15:04")
+	t.Setenv(EnvAddSource, "true")
+	h := NewHandlerFromEnv(io.Discard, &slog.HandlerOptions{Level: slog.LevelWarn})
+	if !h.Enabled(t.Context(), slog.LevelDebug) {
+		t.Error("expected the level of the environment")
+	}
+	if h.depth == ColorDepthNone {
+		t.Error("expected colors")
+	}
+	if h.timeLayout != "15:04" || !h.opts.AddSource {
+		t.Errorf("expected the time format and source of the environment, got %q and %t", h.timeLayout, h.opts.AddSource)
+	}
+
+	t.Setenv(EnvLevel, "loud")
+	t.Setenv(EnvColor, "0")
+	t.Setenv(EnvAddSource, "maybe")
+	h = NewHandlerFromEnv(io.Discard, &slog.HandlerOptions{Level: slog.LevelWarn, AddSource: true})
+	if h.Enabled(t.Context(), slog.LevelInfo) {
+		t.Error("expected an invalid level to be ignored")
+	}
+	if h.depth != ColorDepthNone {
+		t.Error("expected no colors")
+	}
+	if !h.opts.AddSource {
+		t.Error("expected an invalid boolean to be ignored")
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	opts, level := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-log-level", "warn,db=debug", "-log-color", "never", "-log-time", "15:04"}); err != nil {
+		t.Fatal(err)
+	}
+	h := New(io.Discard, opts)
+
+	if level.Level() != slog.LevelWarn || h.Enabled(t.Context(), slog.LevelInfo) {
+		t.Errorf("expected WARN, got %v", level.Level())
+	}
+	if !h.WithGroup("db").Enabled(t.Context(), slog.LevelDebug) {
+		t.Error("expected the level of db")
+	}
+	if !opts.NoColor || h.timeLayout != "15:04" {
+		t.Errorf("expected no colors and the time format, got %t and %q", opts.NoColor, h.timeLayout)
+	}
+
+	level.Set(slog.LevelError)
+	if h.Enabled(t.Context(), slog.LevelWarn) {
+		t.Error("expected the level to follow the LevelVar")
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	RegisterFlags(fs)
+	for _, args := range [][]string{{"-log-level", "loud"}, {"-log-color", "rainbow"}} {
+		if err := fs.Parse(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".devslog.json")
+	config := `{
+		"level": "warn,db=debug",
+		"color": "never",
+		"time_format": "15:04",
+		"add_source": true,
+		"theme": {"key": "cyan", "muted": "244", "levels": {"warn": "#ffaf00"}},
+		"redact_keys": ["*token*"],
+		"redact_mode": "hash",
+		"mask_patterns": ["\\d{4}"]
+	}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Level.Level() != slog.LevelWarn || opts.GroupLevels["db"].Level() != slog.LevelDebug {
+		t.Errorf("expected the levels of the directives, got %v and %v", opts.Level, opts.GroupLevels)
+	}
+	if !opts.NoColor || opts.TimeFormat != "15:04" || !opts.AddSource {
+		t.Errorf("expected no colors, the time format and the source, got %+v", opts)
+	}
+	wantTheme := Theme{Key: Cyan, Muted: Color256(244), Levels: map[slog.Level]Color{slog.LevelWarn: RGB(255, 175, 0)}}
+	if !reflect.DeepEqual(opts.Theme, wantTheme) {
+		t.Errorf("got theme %+v, want %+v", opts.Theme, wantTheme)
+	}
+	if opts.RedactMode != RedactHash || len(opts.RedactKeys) != 1 || len(opts.MaskPatterns) != 1 {
+		t.Errorf("expected the redaction rules, got %+v", opts)
+	}
+
+	for _, config := range []string{
+		`{"levle": "debug"}`,
+		`{"level": "loud"}`,
+		`{"color": "rainbow"}`,
+		`{"theme": "solarized"}`,
+		`{"theme": {"key": "chartreuse"}}`,
+		`{"redact_mode": "blur"}`,
+		`{"mask_patterns": ["("]}`,
+	} {
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("%s: expected an error", config)
+		}
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	h := New(io.Discard)
+	h.SetLevel(slog.LevelWarn)
+	child := h.WithGroup("G").WithAttrs([]slog.Attr{slog.Int("a", 1)})
+	if h.Level() != slog.LevelWarn || child.Enabled(t.Context(), slog.LevelInfo) {
+		t.Fatalf("expected WARN, got %v", h.Level())
+	}
+
+	h.SetLevel(slog.LevelDebug)
+	if h.Level() != slog.LevelDebug || !child.Enabled(t.Context(), slog.LevelDebug) {
+		t.Errorf("expected the level of the handler and its children to be DEBUG, got %v", h.Level())
+	}
+	child.(*Handler).SetLevel(slog.LevelError)
+	if h.Enabled(t.Context(), slog.LevelWarn) {
+		t.Error("expected the level of a child to apply to its parent")
+	}
+
+	// A LevelVar of the caller is used as is.
+	var lv slog.LevelVar
+	h = New(io.Discard, WithLevel(&lv))
+	h.SetLevel(slog.LevelError)
+	if lv.Level() != slog.LevelError {
+		t.Errorf("expected the LevelVar to be set, got %v", lv.Level())
+	}
+
+	// Other Levelers of the caller keep deciding the level.
+	var level atomicLeveler
+	h = New(io.Discard, WithLevel(&level))
+	level.Store(int64(slog.LevelError))
+	if h.Enabled(t.Context(), slog.LevelWarn) {
+		t.Error("expected the Leveler to be followed, got WARN enabled")
+	}
+	h.SetLevel(slog.LevelDebug)
+	if got := h.Level(); got != slog.LevelError {
+		t.Errorf("expected SetLevel to leave the Leveler alone, got %v", got)
+	}
+}
+
+// atomicLeveler is a Leveler that changes without being a LevelVar.
+type atomicLeveler struct{ atomic.Int64 }
+
+func (l *atomicLeveler) Level() slog.Level { return slog.Level(l.Load()) }
+
+func TestStepLevel(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{NoColor: true, HeaderOrder: []HeaderField{HeaderLevel, HeaderMessage}})
+
+	steps := []struct {
+		verbose bool
+		want    slog.Level
+	}{
+		{verbose: true, want: slog.LevelDebug},
+		{verbose: true, want: LevelTrace},
+		{verbose: true, want: LevelTrace},
+		{verbose: false, want: slog.LevelDebug},
+		{verbose: false, want: slog.LevelInfo},
+	}
+	for _, step := range steps {
+		h.stepLevel(step.verbose)
+		if got := h.Level(); got != step.want {
+			t.Errorf("verbose %t: got %v, want %v", step.verbose, got, step.want)
+		}
+	}
+
+	h.SetLevel(slog.LevelWarn + 1)
+	h.stepLevel(false)
+	if got := h.Level(); got != slog.LevelError {
+		t.Errorf("expected a level between steps to go to the next one, got %v", got)
+	}
+
+	want := "DEBUG log level set to DEBUG\nTRACE log level set to TRACE\nTRACE log level set to TRACE\n" +
+		"DEBUG log level set to DEBUG\nINFO log level set to INFO\nERROR log level set to ERROR\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLevelRoutes(t *testing.T) {
+	var info, warn, errs bytes.Buffer
+	h := New(&info, &Options{
+		HandlerOptions: slog.HandlerOptions{Level: slog.LevelDebug},
+		NoColor:        true,
+		LevelRoutes: []LevelRoute{
+			{Level: slog.LevelError, Writer: &errs},
+			{Level: slog.LevelWarn, Writer: &warn},
+		},
+	})
+
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelWarn + 2, slog.LevelError, slog.LevelError + 4} {
+		if err := h.Handle(t.Context(), slog.NewRecord(time.Time{}, level, "msg", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "default", got: info.String(), want: "DEBUG msg\nINFO msg\n"},
+		{name: "warn", got: warn.String(), want: "WARN msg\nWARN+2 msg\n"},
+		{name: "error", got: errs.String(), want: "ERROR msg\nFATAL msg\n"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s\ngot:  %q\nwant: %q", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestRoutesUncomparableWriters(t *testing.T) {
+	var lines []string
+	w := writerFunc(func(p []byte) (int, error) {
+		lines = append(lines, string(p))
+		return len(p), nil
+	})
+	h := New(w, &Options{
+		NoColor:     true,
+		HeaderOrder: []HeaderField{HeaderMessage},
+		LevelRoutes: []LevelRoute{{Level: slog.LevelWarn, Writer: w}},
+	})
+
+	slog.New(h).Warn("routed")
+	b := h.Batch("")
+	slog.New(b).Warn("batched")
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lines) == 0 {
+		t.Error("expected records to be written")
+	}
+}
+
+// writerFunc is a writer whose type can't be compared.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestFatal(t *testing.T) {
+	defer func(l *slog.Logger, code int) {
+		slog.SetDefault(l)
+		exit = os.Exit
+		FatalExitCode = code
+	}(slog.Default(), FatalExitCode)
+
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(New(&buf, &Options{NoColor: true, HeaderOrder: []HeaderField{HeaderLevel, HeaderMessage}})))
+	var codes []int
+	exit = func(code int) { codes = append(codes, code) }
+
+	Fatal("msg", "a", 1)
+	FatalExitCode = 3
+	Fatalf("%d files", 2)
+
+	if want := "FATAL msg\n ↳ a: 1\nFATAL 2 files\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+	if !slices.Equal(codes, []int{1, 3}) {
+		t.Errorf("exit codes = %v, want [1 3]", codes)
+	}
+}
+
+func TestColorValues(t *testing.T) {
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(slog.String("s", "x"), slog.Int("i", 1), slog.Bool("b", true), slog.Any("a", struct{}{}))
+
+	testCases := []struct {
+		name string
+		opts *Options
+		want []string
+	}{
+		{
+			name: "default colors",
+			opts: &Options{ColorValues: true, ColorDepth: ColorDepth16},
+			want: []string{"\033[32mx\033[0m", "\033[36m1\033[0m", "\033[35mtrue\033[0m", ": {}\n"},
+		},
+		{
+			name: "custom colors",
+			opts: &Options{ColorValues: true, ColorDepth: ColorDepth16, KindColors: map[slog.Kind]Color{slog.KindString: Yellow}},
+			want: []string{"\033[33mx\033[0m", "\033[36m1\033[0m"},
+		},
+		{
+			name: "no color",
+			opts: &Options{ColorValues: true, NoColor: true},
+			want: []string{"INFO msg\n ↳ s: x\n ↳ i: 1\n ↳ b: true\n ↳ a: {}\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := New(&buf, tc.opts).Handle(t.Context(), rec); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected output to contain %q\noutput: %q", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestColorMessage(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{
+		ColorMessage: true,
+		ColorDepth:   ColorDepth16,
+		LevelColors:  map[slog.Level]Color{slog.LevelWarn: Magenta},
+	})
+	for _, level := range []slog.Level{slog.LevelError, slog.LevelWarn, slog.LevelDebug} {
+		if err := h.Handle(t.Context(), slog.NewRecord(time.Time{}, level, "msg", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "\033[31mERROR\033[0m \033[31mmsg\033[0m\n" +
+		"\033[35mWARN\033[0m \033[35mmsg\033[0m\n" +
+		"DEBUG msg\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestTheme(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{
+		ColorDepth: ColorDepth16,
+		Theme: Theme{
+			Levels:  map[slog.Level]Color{slog.LevelInfo: Green},
+			Key:     Blue,
+			Group:   Bold,
+			Time:    Yellow,
+			Message: Cyan,
+		},
+	}).WithGroup("G")
+
+	rec := slog.NewRecord(time.Date(2009, time.November, 9, 23, 0, 0, 0, time.UTC), slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(slog.String("k", "v"))
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "\033[33m23:00:00\033[0m \033[32mINFO\033[0m \033[36mmsg\033[0m\n" +
+		" ↳ \033[1mG\033[0m:\n" +
+		"     ↳ \033[34mk\033[0m: v\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestDefaultTheme(t *testing.T) {
+	testCases := []struct {
+		colorfgbg string
+		light     bool
+	}{
+		{colorfgbg: "", light: false},
+		{colorfgbg: "15;0", light: false},
+		{colorfgbg: "0;15", light: true},
+		{colorfgbg: "0;default;7", light: true},
+	}
+
+	for _, tc := range testCases {
+		t.Setenv("COLORFGBG", tc.colorfgbg)
+		h := New(io.Discard, &Options{ColorDepth: ColorDepth16})
+		if light := h.graySeq == "\033[30m"; light != tc.light {
+			t.Errorf("COLORFGBG=%q; got light theme %t, want %t", tc.colorfgbg, light, tc.light)
+		}
+	}
+}
+
+func TestCompactColors(t *testing.T) {
+	rec := slog.NewRecord(time.Time{}, slog.LevelWarn, "msg", 0)
+	rec.AddAttrs(slog.Any("err", errors.New("a\nb")), slog.Any("data", make([]byte, 32)))
+
+	var buf bytes.Buffer
+	h := New(&buf, &Options{Compact: true, ColorDepth: ColorDepth16, Theme: ThemeDark})
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	if !strings.HasPrefix(got, h.levelText(slog.LevelWarn)+" msg ") {
+		t.Errorf("expected the colored level first, got %q", got)
+	}
+	if n := strings.Count(got, "\n"); n != 1 {
+		t.Errorf("expected a single line, got %d: %q", n, got)
+	}
+}
+
+func TestErrorColors(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{ColorDepth: ColorDepth16, Theme: ThemeDark})
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(slog.Any("err", errors.New("boom")), slog.String("s", "boom"))
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	red := colourRed.seq(ColorDepth16)
+	got := buf.String()
+	for _, want := range []string{red + "err" + resetColour, red + `"boom"` + resetColour} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+	if strings.Contains(got, red+"s"+resetColour) {
+		t.Errorf("expected the key of a string not to be red: %q", got)
+	}
+}
+
+// stackError is like the errors of github.com/pkg/errors, which carry the
+// stack trace of where they were created.
+type stackError struct {
+	pcs []uintptr
+}
+
+type testFrame uintptr
+
+func newStackError() error {
+	pcs := make([]uintptr, 8)
+	return &stackError{pcs: pcs[:runtime.Callers(1, pcs)]}
+}
+
+func (e *stackError) Error() string { return "boom" }
+
+func (e *stackError) StackTrace() []testFrame {
+	frames := make([]testFrame, len(e.pcs))
+	for i, pc := range e.pcs {
+		frames[i] = testFrame(pc)
+	}
+	return frames
+}
+
+func TestStackTraces(t *testing.T) {
+	pcs := make([]uintptr, 8)
+	pcs = pcs[:runtime.Callers(1, pcs)]
+
+	var buf bytes.Buffer
+	h := New(&buf, nil)
+	rec := slog.NewRecord(time.Time{}, slog.LevelError, "msg", 0)
+	rec.AddAttrs(
+		slog.Any("err", fmt.Errorf("wrapped: %w", newStackError())),
+		slog.Any("frames", runtime.CallersFrames(pcs)),
+	)
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"\n     caused by: \"boom\" (*devslog.stackError)\n     at devslog.newStackError (",
+		"\n ↳ frames: (",
+		" frames)\n     at devslog.TestStackTraces (",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+	if n := strings.Count(got, "at devslog.newStackError"); n != 1 {
+		t.Errorf("expected the stack trace of the error once, got %d times: %q", n, got)
+	}
+}
+
+func TestStackTraceLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(New(&buf, &Options{StackTraceLevel: slog.LevelError}))
+	logger.Warn("warn", "a", 1)
+	logger.WithGroup("G").Error("error", "a", 1)
+
+	got := buf.String()
+	warn, errRecord, ok := strings.Cut(got, "ERROR")
+	if !ok {
+		t.Fatalf("expected an error record in %q", got)
+	}
+	if strings.Contains(warn, "stack") {
+		t.Errorf("expected no stack trace below WARN: %q", warn)
+	}
+	want := "\n     ↳ a: 1\n ↳ stack: ("
+	if !strings.Contains(errRecord, want) {
+		t.Errorf("expected %q in %q", want, errRecord)
+	}
+	// The trace starts at the call to the logger.
+	want = " frames)\n     at devslog.TestStackTraceLevel ("
+	if !strings.Contains(errRecord, want) {
+		t.Errorf("expected %q in %q", want, errRecord)
+	}
+}
+
+func TestExpandCyclicSlice(t *testing.T) {
+	s := []any{nil}
+	s[0] = s
+
+	for _, maxDepth := range []int{0, 2} {
+		var buf bytes.Buffer
+		logger := slog.New(New(&buf, &Options{NoColor: true, SliceMinLen: 1, MaxDepth: maxDepth, HeaderOrder: []HeaderField{HeaderMessage}}))
+		logger.Info("msg", "s", s)
+
+		got := buf.String()
+		if maxDepth == 0 {
+			if n := strings.Count(got, "↳ 0:"); n != maxDepthCount || !strings.HasSuffix(got, "↳ 0: …\n") {
+				t.Errorf("expected %d levels ending with …, got %d: %q", maxDepthCount, n, got)
+			}
+			continue
+		}
+		want := "msg\n ↳ s:\n     ↳ 0:\n         ↳ 0: … (100 more levels)\n"
+		if got != want {
+			t.Errorf("\ngot:  %q\nwant: %q", got, want)
+		}
+	}
+}
+
+// panicError is an error whose methods panic.
+type panicError struct{}
+
+func (panicError) Error() string { panic("boom") }
+
+func (panicError) StackTrace() []uintptr { panic("boom") }
+
+// panicStringer is a value whose String method panics.
+type panicStringer struct{}
+
+func (panicStringer) String() string { panic("boom") }
+
+func TestPanickingValues(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		for _, v := range []any{panicError{}, panicStringer{}} {
+			var buf bytes.Buffer
+			logger := slog.New(New(&buf, &Options{Compact: compact, NoColor: true}))
+			logger.Info("msg", "v", v, "a", 1)
+
+			want := "\n ↳ v: !PANIC formatting value: boom\n ↳ a: 1\n"
+			if compact {
+				want = ` v="!PANIC formatting value: boom" a=1`
+			}
+			if got := buf.String(); !strings.Contains(got, want) {
+				t.Errorf("compact %t, %T: expected %q in %q", compact, v, want, got)
+			}
+		}
+	}
+
+	// Values that fmt renders, below the levels of ExpandStructs, and the
+	// values of the sidebar get the same placeholder.
+	var buf bytes.Buffer
+	logger := slog.New(New(&buf, &Options{
+		NoColor:       true,
+		HeaderOrder:   []HeaderField{HeaderMessage},
+		ExpandStructs: 1,
+		SidebarKeys:   []string{"req"},
+		SidebarWidth:  40,
+		Width:         80,
+	}))
+	type inner struct{ S panicStringer }
+	logger.Info("msg", "req", panicStringer{}, "v", struct{ In inner }{})
+
+	want := "msg" + strings.Repeat(" ", 44) + "req=!PANIC formatting value: boom\n" +
+		" ↳ v:\n     ↳ In: {S:!PANIC formatting value: boom}\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestPanickingFormatters(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(New(&buf, &Options{
+		NoColor:     true,
+		HeaderOrder: []HeaderField{HeaderMessage},
+		KeyFormats: []KeyFormat{{Key: "status", Format: func(v slog.Value) (string, Color) {
+			panic("bang")
+		}}},
+		ValueFormatters: []ValueFormatter{func(v any) (string, bool) {
+			if _, ok := v.(testUser); ok {
+				panic("boom")
+			}
+			return "", false
+		}},
+	}))
+	logger.Info("msg", "user", testUser{Name: "ann"}, "status", 200, "a", 1)
+
+	want := "msg\n ↳ user: !PANIC formatting value: boom\n ↳ status: !PANIC formatting value: bang\n ↳ a: 1\n"
+	if got := buf.String(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestKeyFormatColors(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{
+		ColorDepth: ColorDepth16,
+		KeyFormats: []KeyFormat{{Key: "status", Format: func(v slog.Value) (string, Color) {
+			if v.Int64() >= 500 {
+				return v.String(), Red
+			}
+			return v.String(), Green
+		}}},
+	})
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(slog.Int("status", 503))
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := Red.seq(ColorDepth16) + "503" + resetColour; !strings.Contains(buf.String(), want) {
+		t.Errorf("expected %q in %q", want, buf.String())
+	}
+}
+
+func TestPrettyJSONColors(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{PrettyJSON: true, ColorDepth: ColorDepth16, Theme: ThemeDark})
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(slog.String("a", `{"k\"ey": "v", "n": -1.5e3, "t": false, "z": null}`))
+	if err := h.Handle(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		h.styled(h.keySeq, `"k\"ey"`) + ": " + h.text(Green, `"v"`) + ",",
+		h.text(Cyan, "-1.5e3"),
+		h.text(Magenta, "false"),
+		h.gray("null"),
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected output to contain %q\noutput: %q", want, buf.String())
+		}
+	}
+}
+
+func TestValueMarkers(t *testing.T) {
+	rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+	rec.AddAttrs(slog.Bool("t", true), slog.Bool("f", false), slog.Any("n", nil), slog.Any("p", (*int)(nil)))
+
+	testCases := []struct {
+		name string
+		opts *Options
+		want []string
+	}{
+		{
+			name: "markers",
+			opts: &Options{ValueMarkers: true, ColorValues: true, ColorDepth: ColorDepth16, Theme: ThemeDark},
+			want: []string{"t\033[0m: \033[32mtrue\033[0m", "f\033[0m: \033[31mfalse\033[0m", "n\033[0m: \033[3m\033[90m<nil>", "p\033[0m: \033[3m\033[90m<nil>"},
+		},
+		{
+			name: "no color",
+			opts: &Options{ValueMarkers: true, NoColor: true},
+			want: []string{"INFO msg\n ↳ t: true\n ↳ f: false\n ↳ n: <nil>\n ↳ p: <nil>\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := New(&buf, tc.opts).Handle(t.Context(), rec); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("expected output to contain %q\noutput: %q", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestGroupRoutes(t *testing.T) {
+	var main, db, cache bytes.Buffer
+	h := New(&main, &Options{
+		NoColor: true,
+		GroupRoutes: []GroupRoute{
+			{Group: "db", Writer: &db},
+			{Group: "cache", Writer: &cache, Exclusive: true},
+		},
+	})
+
+	logger := slog.New(h)
+	logger.Info("app")
+	logger.WithGroup("db").Info("query")
+	logger.WithGroup("cache").WithGroup("db").Info("hit")
+	logger.WithGroup("http").WithGroup("db").Info("request")
+
+	for _, tc := range []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "main", got: main.String(), want: "app\nquery\nrequest\n"},
+		{name: "db", got: db.String(), want: "query\n"},
+		{name: "cache", got: cache.String(), want: "hit\n"},
+	} {
+		var msgs []string
+		for line := range strings.Lines(tc.got) {
+			msgs = append(msgs, line[strings.LastIndexByte(line, ' ')+1:])
+		}
+		if got := strings.Join(msgs, ""); got != tc.want {
+			t.Errorf("%s\ngot:  %q\nwant: %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStyleRules(t *testing.T) {
+	opts := &Options{
+		ColorDepth:  ColorDepth16,
+		Theme:       ThemeDark,
+		HeaderOrder: []HeaderField{HeaderMessage},
+		StyleRules:  []StyleRule{{Key: "cached", Value: true, Style: Dim}},
+	}
+
+	testCases := []struct {
+		name  string
+		opts  *Options
+		attrs []slog.Attr
+		want  string
+	}{
+		{
+			name:  "match",
+			opts:  opts,
+			attrs: []slog.Attr{slog.Bool("cached", true)},
+			want:  "\033[2mmsg\033[0m\n\033[2m ↳ \033[90mcached\033[0m\033[2m: true\033[0m\n",
+		},
+		{
+			name:  "no match",
+			opts:  opts,
+			attrs: []slog.Attr{slog.Bool("cached", false)},
+			want:  "msg\n ↳ \033[90mcached\033[0m: false\n",
+		},
+		{
+			name:  "no color",
+			opts:  &Options{HeaderOrder: opts.HeaderOrder, StyleRules: opts.StyleRules, NoColor: true},
+			attrs: []slog.Attr{slog.Bool("cached", true)},
+			want:  "msg\n ↳ cached: true\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)
+			rec.AddAttrs(tc.attrs...)
+
+			var buf bytes.Buffer
+			if err := New(&buf, tc.opts).Handle(t.Context(), rec); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGoroutineID(t *testing.T) {
+	var buf bytes.Buffer
+	h := New(&buf, &Options{GoroutineID: true, NoColor: true})
+	if err := h.Handle(t.Context(), slog.NewRecord(time.Time{}, slog.LevelInfo, "msg", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	level, rest, _ := strings.Cut(buf.String(), " ")
+	id, msg, _ := strings.Cut(rest, " ")
+	if level != "INFO" || msg != "msg\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(id, "g")); err != nil || n <= 0 || !strings.HasPrefix(id, "g") {
+		t.Errorf("invalid goroutine ID %q", id)
+	}
+}
+
+func TestColorDepth(t *testing.T) {
+	testCases := []struct {
+		name  string
+		color Color
+		depth ColorDepth
+		want  string
+	}{
+		{name: "none", color: Red, depth: ColorDepthNone, want: ""},
+		{name: "basic", color: Red, depth: ColorDepthTrue, want: "\033[31m"},
+		{name: "truecolor", color: RGB(255, 95, 95), depth: ColorDepthTrue, want: "\033[38;2;255;95;95m"},
+		{name: "truecolor to 256", color: RGB(255, 95, 95), depth: ColorDepth256, want: "\033[38;5;203m"},
+		{name: "truecolor to 16", color: RGB(250, 10, 10), depth: ColorDepth16, want: "\033[91m"},
+		{name: "256 to 16", color: Color256(245), depth: ColorDepth16, want: "\033[90m"},
+		{name: "gray to 256", color: RGB(128, 128, 128), depth: ColorDepth256, want: "\033[38;5;244m"},
+		{name: "with attributes", color: "1;" + Color256(46), depth: ColorDepth16, want: "\033[1;92m"},
+		{name: "adaptive", color: Adaptive(RGB(1, 2, 3), Color256(203), Red), depth: ColorDepth256, want: "\033[38;5;203m"},
+		{name: "adaptive fallback", color: Adaptive(RGB(1, 2, 3), Color256(203), Red), depth: ColorDepth16, want: "\033[31m"},
+		{name: "adaptive degraded", color: Adaptive(RGB(255, 95, 95)), depth: ColorDepth256, want: "\033[38;5;203m"},
+		{name: "hex", color: Hex("#ff5f5f"), depth: ColorDepthTrue, want: "\033[38;2;255;95;95m"},
+		{name: "short hex", color: Hex("f55"), depth: ColorDepthTrue, want: "\033[38;2;255;85;85m"},
+		{name: "invalid hex", color: Hex("#ff5f5g"), depth: ColorDepthTrue, want: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.color.seq(tc.depth); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestColorEnv(t *testing.T) {
+	testCases := []struct {
+		env   map[string]string
+		depth ColorDepth
+		want  ColorDepth
+	}{
+		{env: map[string]string{}, depth: ColorDepth256, want: ColorDepth256},
+		{env: map[string]string{"NO_COLOR": "1"}, depth: ColorDepth256, want: ColorDepthNone},
+		{env: map[string]string{"NO_COLOR": ""}, depth: ColorDepth256, want: ColorDepth256},
+		{env: map[string]string{"CLICOLOR": "0"}, depth: ColorDepth16, want: ColorDepthNone},
+		{env: map[string]string{"CLICOLOR_FORCE": "1", "NO_COLOR": "1"}, depth: ColorDepthNone, want: ColorDepth16},
+		{env: map[string]string{"FORCE_COLOR": "3"}, depth: ColorDepthNone, want: ColorDepthTrue},
+		{env: map[string]string{"FORCE_COLOR": ""}, depth: ColorDepth256, want: ColorDepth256},
+		{env: map[string]string{"FORCE_COLOR": "false"}, depth: ColorDepth256, want: ColorDepthNone},
+	}
+
+	for _, tc := range testCases {
+		for _, name := range []string{"NO_COLOR", "CLICOLOR", "CLICOLOR_FORCE", "FORCE_COLOR"} {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+		for name, val := range tc.env {
+			t.Setenv(name, val)
+		}
+		if got := colorEnv(tc.depth); got != tc.want {
+			t.Errorf("env %v, depth %d; got %d, want %d", tc.env, tc.depth, got, tc.want)
+		}
+	}
+
+	t.Setenv("FORCE_COLOR", "3")
+	if h := New(io.Discard, &Options{IgnoreColorEnv: true}); h.depth != ColorDepthNone {
+		t.Error("expected IgnoreColorEnv to ignore FORCE_COLOR")
+	}
+}
+
+func TestNonTerminal(t *testing.T) {
+	t.Setenv("COLORTERM", "")
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("NO_COLOR", "1")
+
+	testCases := []struct {
+		name string
+		opts *Options
+		want ColorDepth
+	}{
+		{name: "default", opts: nil, want: ColorDepthNone},
+		{name: "force color", opts: &Options{ForceColor: true}, want: ColorDepth256},
+		{name: "no color", opts: &Options{ForceColor: true, NoColor: true}, want: ColorDepthNone},
+		{name: "explicit depth", opts: &Options{ColorDepth: ColorDepth16}, want: ColorDepth16},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := New(&bytes.Buffer{}, tc.opts).depth; got != tc.want {
+				t.Errorf("got %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectColorDepth(t *testing.T) {
+	testCases := []struct {
+		colorterm, term, termProgram string
+		want                         ColorDepth
+	}{
+		{colorterm: "truecolor", term: "xterm", want: ColorDepthTrue},
+		{termProgram: "iTerm.app", term: "xterm-256color", want: ColorDepthTrue},
+		{termProgram: "Apple_Terminal", term: "xterm-256color", want: ColorDepth256},
+		{colorterm: "24bit", term: "", want: ColorDepthTrue},
+		{term: "xterm-256color", want: ColorDepth256},
+		{term: "dumb", want: ColorDepthNone},
+		{term: "xterm", want: ColorDepth16},
+		{term: "", want: ColorDepth16},
+	}
+
+	t.Setenv("WT_SESSION", "")
+	for _, tc := range testCases {
+		t.Setenv("COLORTERM", tc.colorterm)
+		t.Setenv("TERM", tc.term)
+		t.Setenv("TERM_PROGRAM", tc.termProgram)
+		if got := detectColorDepth(); got != tc.want {
+			t.Errorf("COLORTERM=%q TERM=%q TERM_PROGRAM=%q; got %d, want %d", tc.colorterm, tc.term, tc.termProgram, got, tc.want)
+		}
 	}
 }
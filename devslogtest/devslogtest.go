@@ -0,0 +1,354 @@
+// Package devslogtest parses the output of a [devslog.Handler], so that tests
+// can make assertions about what was logged without depending on the exact
+// layout of the output.
+package devslogtest
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/romantomjak/devslog"
+)
+
+const (
+	// attrPrefix and asciiAttrPrefix precede the key of each attribute, by
+	// default and with Options.ASCII.
+	attrPrefix      = "↳"
+	asciiAttrPrefix = "->"
+	// kvd and asciiKVD separate the key of an attribute from its value, by
+	// default and with Options.ASCII.
+	kvd      = ":"
+	asciiKVD = " ="
+
+	defaultFrameStart = "┌──"
+	defaultFrameEnd   = "└──"
+)
+
+// ansiRE matches the CSI and OSC escape sequences that the handler writes.
+var ansiRE = regexp.MustCompile("\033\\[[0-?]*[ -/]*[@-~]|\033\\][^\a\033]*(?:\a|\033\\\\)")
+
+// StripANSI removes the ANSI escape sequences, such as colors and hyperlinks,
+// from s.
+func StripANSI(s string) string {
+	return ansiRE.ReplaceAllString(s, "")
+}
+
+// ParseOutput parses the records that a handler created with opts wrote to r.
+// opts may be nil. Each record is returned as a map with the keys of
+// [slog.TimeKey], [slog.LevelKey], [slog.SourceKey] and [slog.MessageKey] for
+// the fields of its first line that are present, and the keys of its
+// attributes. Groups are nested maps, and values are the strings that were
+// written. The lines of values that span several lines, such as hex dumps, are
+// joined with newlines.
+//
+// ParseOutput follows Options.HeaderOrder and skips the lines of
+// Options.Frame, Options.DateBanner, Options.Legend and Options.KeyPrefix.
+// The keys of Options.FlattenGroups are split into nested maps, which assumes
+// that the names of groups and keys don't contain the separator. Compact
+// output and the sidebar are not supported.
+func ParseOutput(r io.Reader, opts *devslog.Options) ([]map[string]any, error) {
+	if opts == nil {
+		opts = &devslog.Options{}
+	}
+	order := opts.HeaderOrder
+	if len(order) == 0 {
+		order = []devslog.HeaderField{
+			devslog.HeaderTime,
+			devslog.HeaderElapsed,
+			devslog.HeaderLevel,
+			devslog.HeaderGoroutine,
+			devslog.HeaderSource,
+			devslog.HeaderMessage,
+			devslog.HeaderAttrCount,
+		}
+	}
+	frameStart, frameEnd := opts.FrameStart, opts.FrameEnd
+	if frameStart == "" {
+		frameStart = defaultFrameStart
+	}
+	if frameEnd == "" {
+		frameEnd = defaultFrameEnd
+	}
+
+	syn := newSyntax(opts)
+	var records []map[string]any
+	var p *recordParser
+	inPreamble := opts.Legend || opts.KeyPrefix != ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := StripANSI(scanner.Text())
+		if inPreamble && isPreamble(line) {
+			continue
+		}
+		inPreamble = false
+
+		switch {
+		case opts.Frame && (line == frameStart || line == frameEnd):
+		case opts.DateBanner && strings.HasPrefix(line, "── "):
+		case line != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t"):
+			p = newRecordParser(parseFirstLine(line, order), syn)
+			records = append(records, p.record)
+		case p == nil:
+			return nil, fmt.Errorf("line %d: attribute line before the first record", n)
+		default:
+			if err := p.parseLine(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		}
+	}
+	return records, scanner.Err()
+}
+
+// isPreamble reports whether line is one of the lines that the handler writes
+// before the first record: the lines of the legend and the notice about the
+// key prefix.
+func isPreamble(line string) bool {
+	return line == "legend:" ||
+		strings.HasPrefix(line, "  ") ||
+		strings.HasPrefix(line, "keys are shown without the prefix ")
+}
+
+// parseFirstLine parses the fields of the first line of a record. The fields
+// other than the message have no spaces, except for the attribute count, so
+// the message is whatever remains after taking the fields before it from the
+// start of the line and the fields after it from the end.
+func parseFirstLine(line string, order []devslog.HeaderField) map[string]any {
+	record := make(map[string]any)
+	tokens := strings.Split(line, " ")
+
+	msgAt := len(order)
+	for i, field := range order {
+		if field == devslog.HeaderMessage {
+			msgAt = i
+		}
+	}
+	for _, field := range order[:msgAt] {
+		if len(tokens) == 0 {
+			break
+		}
+		if n := fieldTokens(field, tokens, false); n > 0 {
+			setField(record, field, strings.Join(tokens[:n], " "))
+			tokens = tokens[n:]
+		}
+	}
+	if msgAt < len(order) {
+		for i := len(order) - 1; i > msgAt && len(tokens) > 0; i-- {
+			if n := fieldTokens(order[i], tokens, true); n > 0 {
+				setField(record, order[i], strings.Join(tokens[len(tokens)-n:], " "))
+				tokens = tokens[:len(tokens)-n]
+			}
+		}
+		record[slog.MessageKey] = strings.Join(tokens, " ")
+	}
+	return record
+}
+
+// fieldTokens returns the number of tokens at the start of tokens, or at the
+// end if fromEnd is true, that make up field. It returns 0 if the field isn't
+// there.
+func fieldTokens(field devslog.HeaderField, tokens []string, fromEnd bool) int {
+	tok := tokens[0]
+	if fromEnd {
+		tok = tokens[len(tokens)-1]
+	}
+
+	switch field {
+	case devslog.HeaderTime:
+		// Times and time deltas start with a digit or a sign.
+		t := strings.TrimLeft(tok, "+-")
+		if t != "" && unicode.IsDigit(rune(t[0])) {
+			return 1
+		}
+	case devslog.HeaderElapsed:
+		if strings.HasPrefix(tok, "T+") || strings.HasPrefix(tok, "T-") {
+			return 1
+		}
+	case devslog.HeaderLevel:
+		return 1
+	case devslog.HeaderSource:
+		if strings.Contains(tok, ".go:") {
+			return 1
+		}
+	case devslog.HeaderGoroutine:
+		if id, ok := strings.CutPrefix(tok, "g"); ok && id != "" && strings.Trim(id, "0123456789") == "" {
+			return 1
+		}
+	case devslog.HeaderAttrCount:
+		// "[1 attr]" or "[7 attrs]".
+		if len(tokens) < 2 {
+			return 0
+		}
+		pair := tokens[:2]
+		if fromEnd {
+			pair = tokens[len(tokens)-2:]
+		}
+		if strings.HasPrefix(pair[0], "[") && (pair[1] == "attr]" || pair[1] == "attrs]") {
+			return 2
+		}
+	}
+	return 0
+}
+
+// setField sets the key of field in record. Fields that are not attributes of
+// the record, like the goroutine and the attribute count, are left out.
+func setField(record map[string]any, field devslog.HeaderField, val string) {
+	switch field {
+	case devslog.HeaderTime:
+		record[slog.TimeKey] = val
+	case devslog.HeaderLevel:
+		record[slog.LevelKey] = val
+	case devslog.HeaderSource:
+		record[slog.SourceKey] = val
+	}
+}
+
+// syntax describes the attribute lines of the output of a handler.
+type syntax struct {
+	// prefixes are the symbols that can precede the key of an attribute, and
+	// delim is the key-value delimiter.
+	prefixes []string
+	delim    string
+	// aligned is true when values are padded to line up, with the
+	// Options.AlignKeys option.
+	aligned bool
+	// groupSep splits the keys of Options.FlattenGroups into the names of
+	// their groups. It's empty when groups are not flattened.
+	groupSep string
+}
+
+func newSyntax(opts *devslog.Options) syntax {
+	prefix, delim := attrPrefix, kvd
+	if opts.ASCII {
+		prefix, delim = asciiAttrPrefix, asciiKVD
+	}
+	prefixes := []string{cmp.Or(opts.AttrPrefix, prefix)}
+	if opts.TreeConnectors {
+		// The pipe of "|- " is taken for indentation in ASCII.
+		prefixes = []string{"├─", "└─"}
+		if opts.ASCII {
+			prefixes = []string{"-", "`-"}
+		}
+	}
+	syn := syntax{
+		prefixes: prefixes,
+		delim:    cmp.Or(opts.KeyValueDelimiter, delim),
+		aligned:  opts.AlignKeys,
+	}
+	if opts.FlattenGroups {
+		syn.groupSep = cmp.Or(opts.GroupSeparator, ".")
+	}
+	return syn
+}
+
+// recordParser builds the attributes of a record from its attribute lines.
+type recordParser struct {
+	record map[string]any
+
+	syn syntax
+
+	// stack holds the maps of the groups that are open, with the least
+	// indentation of their attributes.
+	stack []group
+
+	// last is the map and the key of the previous scalar attribute, which
+	// continuation lines are appended to.
+	last    map[string]any
+	lastKey string
+	// block is true when the previous value is a block of lines, whose
+	// first line has the indentation blockIndent, or -1 before it.
+	block       bool
+	blockIndent int
+}
+
+type group struct {
+	m      map[string]any
+	indent int
+}
+
+func newRecordParser(record map[string]any, syn syntax) *recordParser {
+	return &recordParser{record: record, syn: syn, stack: []group{{m: record}}}
+}
+
+// parseLine parses a line after the first line of a record.
+func (p *recordParser) parseLine(line string) error {
+	// The guides of Options.TreeGuides and tabs of Options.Indent take the
+	// place of spaces.
+	trimmed := strings.TrimLeft(line, " \t│|")
+	indent := utf8.RuneCountInString(line[:len(line)-len(trimmed)])
+	line = strings.Repeat(" ", indent) + trimmed
+	var rest string
+	var ok bool
+	for _, prefix := range p.syn.prefixes {
+		if rest, ok = strings.CutPrefix(line[indent:], prefix+" "); ok {
+			break
+		}
+	}
+	if !ok {
+		// A continuation of the previous value.
+		if p.last == nil {
+			return fmt.Errorf("unexpected line %q", line)
+		}
+		if !p.block {
+			p.last[p.lastKey] = p.last[p.lastKey].(string) + "\n" + strings.TrimSpace(line)
+			return nil
+		}
+		// Keep the indentation of the lines of a block relative to its first
+		// line.
+		if p.blockIndent < 0 {
+			p.blockIndent = indent
+			p.last[p.lastKey] = line[indent:]
+			return nil
+		}
+		p.last[p.lastKey] = p.last[p.lastKey].(string) + "\n" + line[min(indent, p.blockIndent):]
+		return nil
+	}
+
+	for len(p.stack) > 1 && indent < p.stack[len(p.stack)-1].indent {
+		p.stack = p.stack[:len(p.stack)-1]
+	}
+	cur := p.stack[len(p.stack)-1].m
+
+	// A group has nothing after the delimiter, while a scalar always has a
+	// space, even when its value is empty.
+	if key, ok := strings.CutSuffix(rest, p.syn.delim); ok {
+		m := make(map[string]any)
+		cur[key] = m
+		p.stack = append(p.stack, group{m: m, indent: indent + 1})
+		p.last = nil
+		return nil
+	}
+	key, val, ok := strings.Cut(rest, p.syn.delim+" ")
+	if !ok {
+		return fmt.Errorf("missing %q in attribute line %q", p.syn.delim, line)
+	}
+	if p.syn.aligned {
+		val = strings.TrimLeft(val, " ")
+	}
+	if p.syn.groupSep != "" {
+		path := strings.Split(key, p.syn.groupSep)
+		for _, name := range path[:len(path)-1] {
+			m, ok := cur[name].(map[string]any)
+			if !ok {
+				m = make(map[string]any)
+				cur[name] = m
+			}
+			cur = m
+		}
+		key = path[len(path)-1]
+	}
+	// Values with several lines are written as a block below the key.
+	p.block, p.blockIndent = val == "|", -1
+	if p.block {
+		val = ""
+	}
+	cur[key] = val
+	p.last, p.lastKey = cur, key
+	return nil
+}
@@ -0,0 +1,95 @@
+package devslogtest
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"testing"
+	"testing/slogtest"
+	"time"
+
+	"github.com/romantomjak/devslog"
+)
+
+func TestSlogtest(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts *devslog.Options
+	}{
+		{name: "default", opts: nil},
+		{name: "header order", opts: &devslog.Options{HeaderOrder: []devslog.HeaderField{devslog.HeaderMessage, devslog.HeaderLevel, devslog.HeaderTime}}},
+		{name: "frame", opts: &devslog.Options{Frame: true}},
+		{name: "attr count", opts: &devslog.Options{AttrCount: true, GoroutineID: true}},
+		{name: "tree guides", opts: &devslog.Options{TreeGuides: true}},
+		{name: "two spaces", opts: &devslog.Options{Indent: "  "}},
+		{name: "tabs", opts: &devslog.Options{Indent: "\t"}},
+		{name: "ascii", opts: &devslog.Options{ASCII: true, TreeGuides: true}},
+		{name: "flatten groups", opts: &devslog.Options{FlattenGroups: true, GroupSeparator: "/"}},
+		{name: "align keys", opts: &devslog.Options{AlignKeys: true}},
+		{name: "tree connectors", opts: &devslog.Options{TreeConnectors: true}},
+		{name: "tree connectors in ascii", opts: &devslog.Options{TreeConnectors: true, ASCII: true}},
+		{name: "custom prefix", opts: &devslog.Options{AttrPrefix: "*", KeyValueDelimiter: " ="}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			newHandler := func(t *testing.T) slog.Handler {
+				buf.Reset()
+				return devslog.New(&buf, tc.opts)
+			}
+			result := func(t *testing.T) map[string]any {
+				records, err := ParseOutput(&buf, tc.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(records) != 1 {
+					t.Fatalf("expected 1 record, got %d", len(records))
+				}
+				return records[0]
+			}
+
+			slogtest.Run(t, newHandler, result)
+		})
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	opts := &devslog.Options{Legend: true, AttrCount: true, Elapsed: true, HexDumpMinLen: 4}
+
+	var buf bytes.Buffer
+	logger := slog.New(devslog.New(&buf, opts))
+	logger.Info("hello, world", "empty", "", slog.Group("G", "bytes", []byte("abcdef")))
+	logger.Warn("bye", "n", 1, "text", "a\n  b")
+
+	got, err := ParseOutput(&buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Format(time.TimeOnly)
+	want := []map[string]any{
+		{
+			slog.TimeKey:    got[0][slog.TimeKey],
+			slog.LevelKey:   "INFO",
+			slog.MessageKey: "hello, world",
+			"empty":         "",
+			"G": map[string]any{
+				"bytes": "(6 bytes)\n00000000  61 62 63 64 65 66                                 |abcdef|",
+			},
+		},
+		{
+			slog.TimeKey:    got[1][slog.TimeKey],
+			slog.LevelKey:   "WARN",
+			slog.MessageKey: "bye",
+			"n":             "1",
+			"text":          "a\n  b",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot:  %v\nwant: %v", got, want)
+	}
+	if s, _ := got[0][slog.TimeKey].(string); len(s) != len(now) {
+		t.Errorf("wrong time %q", s)
+	}
+}
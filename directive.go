@@ -0,0 +1,98 @@
+package devslog
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+)
+
+// ParseLevelDirectives parses directives in the style of Rust's env_logger,
+// such as "info,db=debug,http.client=warn", into an option. A bare level sets
+// the Level option, and a component=level pair sets the minimum level of a
+// component in the GroupLevels option: a path of groups opened with WithGroup,
+// or the value of the ComponentKey attribute. Levels are the names of the
+// slog levels, TRACE and FATAL, regardless of case, and the ones that
+// [slog.Level.UnmarshalText] understands, such as "warn+2".
+func ParseLevelDirectives(directives string) (Option, error) {
+	level, groups, err := parseLevelDirectives(directives)
+	if err != nil {
+		return nil, err
+	}
+	return optionFunc(func(opts *Options) {
+		if level != nil {
+			opts.Level = newLevelVar(level.Level())
+		}
+		mergeGroupLevels(opts, groups)
+	}), nil
+}
+
+// parseLevelDirectives returns the level of the bare level of directives, or
+// nil if there's none, and the levels of their components.
+func parseLevelDirectives(directives string) (slog.Leveler, map[string]slog.Leveler, error) {
+	var level slog.Leveler
+	groups := make(map[string]slog.Leveler)
+	for d := range strings.SplitSeq(directives, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		component, name, ok := strings.Cut(d, "=")
+		if !ok {
+			component, name = "", d
+		}
+		component = strings.TrimSpace(component)
+		if ok && component == "" {
+			return nil, nil, fmt.Errorf("devslog: directive %q has no component", d)
+		}
+		l, err := parseLevel(nil, strings.TrimSpace(name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("devslog: directive %q: %w", d, err)
+		}
+		if component == "" {
+			level = l
+		} else {
+			groups[component] = l
+		}
+	}
+	return level, groups, nil
+}
+
+// newLevelVar returns a LevelVar set to level, so that SetLevel can change the
+// levels that are parsed rather than given by the caller.
+func newLevelVar(level slog.Level) *slog.LevelVar {
+	lv := new(slog.LevelVar)
+	lv.Set(level)
+	return lv
+}
+
+// mergeGroupLevels adds groups to the GroupLevels option, without modifying
+// the map of the caller.
+func mergeGroupLevels(opts *Options, groups map[string]slog.Leveler) {
+	if len(groups) == 0 {
+		return
+	}
+	merged := maps.Clone(opts.GroupLevels)
+	if merged == nil {
+		merged = make(map[string]slog.Leveler, len(groups))
+	}
+	maps.Copy(merged, groups)
+	opts.GroupLevels = merged
+}
+
+// levelEnv applies the directives of the environment variable named by the
+// LevelEnv option to opts. Invalid directives are ignored, since there's no
+// one to report them to.
+func levelEnv(opts *Options) {
+	if opts.LevelEnv == "" {
+		return
+	}
+	directives := os.Getenv(opts.LevelEnv)
+	if directives == "" {
+		return
+	}
+	if opt, err := ParseLevelDirectives(directives); err == nil {
+		opt.apply(opts)
+	}
+}
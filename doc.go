@@ -28,5 +28,11 @@ handler to format the records. [SetDefault] also updates the default logger
 used by the [log] package, so that existing applications that use [log.Printf]
 and related functions will send log records to the logger's handler without
 needing to be rewritten.
+
+The handler set by [SetDefault] reads the environment variables DEVSLOG_LEVEL,
+DEVSLOG_COLOR, DEVSLOG_TIME_FORMAT and DEVSLOG_ADD_SOURCE, which override its
+options, so that the output can be tweaked without recompiling:
+
+	DEVSLOG_LEVEL=info,db=debug DEVSLOG_COLOR=never go run .
 */
 package devslog
@@ -0,0 +1,72 @@
+package devslog
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The environment variables read by [NewHandlerFromEnv].
+const (
+	// EnvLevel holds level directives, such as "debug" or "info,db=debug",
+	// in the syntax of [ParseLevelDirectives].
+	EnvLevel = "DEVSLOG_LEVEL"
+	// EnvColor is "always", "never" or "auto", or a boolean, to force colors
+	// on or off.
+	EnvColor = "DEVSLOG_COLOR"
+	// EnvTimeFormat is the layout of times, like Options.TimeFormat.
+	EnvTimeFormat = "DEVSLOG_TIME_FORMAT"
+	// EnvAddSource is a boolean, like [slog.HandlerOptions.AddSource].
+	EnvAddSource = "DEVSLOG_ADD_SOURCE"
+)
+
+// NewHandlerFromEnv is like [NewHandler], with the options overridden by the
+// environment variables EnvLevel, EnvColor, EnvTimeFormat and EnvAddSource,
+// so that the verbosity and the format of the output can be changed without
+// recompiling. Invalid values are ignored.
+func NewHandlerFromEnv(w io.Writer, opts *slog.HandlerOptions) *Handler {
+	if opts == nil {
+		opts = &slog.HandlerOptions{}
+	}
+	o := Options{HandlerOptions: *opts}
+	envOptions(&o)
+	return newHandler(w, o)
+}
+
+// envOptions applies the environment variables of NewHandlerFromEnv to opts.
+func envOptions(opts *Options) {
+	opts.LevelEnv = EnvLevel
+
+	setColor(opts, os.Getenv(EnvColor))
+
+	if layout := os.Getenv(EnvTimeFormat); layout != "" {
+		opts.TimeFormat = layout
+	}
+
+	if on, err := strconv.ParseBool(os.Getenv(EnvAddSource)); err == nil {
+		opts.AddSource = on
+	}
+}
+
+// setColor forces colors on or off, or leaves them to be detected, as set by
+// mode: "always", "never" or "auto", regardless of case, or a boolean. It
+// reports false if mode is none of them.
+func setColor(opts *Options, mode string) bool {
+	switch strings.ToLower(mode) {
+	case "always":
+		opts.NoColor, opts.ForceColor = false, true
+	case "never":
+		opts.NoColor, opts.ForceColor = true, false
+	case "auto":
+		opts.NoColor, opts.ForceColor = false, false
+	default:
+		on, err := strconv.ParseBool(mode)
+		if err != nil {
+			return false
+		}
+		opts.NoColor, opts.ForceColor = !on, on
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package devslog
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// errorValue returns the error held by v. It reports false if v doesn't hold
+// an error, or holds a nil pointer to one.
+func errorValue(v slog.Value) (error, bool) {
+	if v.Kind() != slog.KindAny || isNil(v) {
+		return nil, false
+	}
+	err, ok := v.Any().(error)
+	return err, ok
+}
+
+// attrKeySeq returns the escape sequence of the key of an attribute with the
+// value v: the one of errors for errors, and the one of keys otherwise.
+func (h *Handler) attrKeySeq(v slog.Value) string {
+	if _, ok := errorValue(v); ok {
+		return colourRed.seq(h.depth)
+	}
+	return h.keySeq
+}
+
+// errorText renders err as its quoted message, followed by its type, as in
+// `"file not found" (*fs.PathError)`, so that it doesn't pass for a string.
+// Errors that join several errors are rendered as their number instead, since
+// errorCauses renders them.
+func (h *Handler) errorText(err error) string {
+	var msg string
+	if errs, ok := joinedErrors(err); ok {
+		msg = strconv.Itoa(len(errs)) + " errors"
+	} else {
+		msg = strconv.Quote(h.truncate(err.Error()))
+	}
+	return h.text(colourRed, msg) + " " + h.gray("("+fmt.Sprintf("%T", err)+")")
+}
+
+// joinedErrors returns the errors that err joins, if it's made by
+// [errors.Join] or otherwise has an Unwrap() []error method.
+func joinedErrors(err error) ([]error, bool) {
+	j, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil, false
+	}
+	var errs []error
+	for _, e := range j.Unwrap() {
+		if e != nil {
+			errs = append(errs, e)
+		}
+	}
+	return errs, true
+}
+
+// maxErrorCauses is how deep the causes of an error are shown, since an error
+// can unwrap to itself.
+const maxErrorCauses = 100
+
+// errorCauses returns the lines of the errors that err wraps: a line for each
+// error of its chain, as in `caused by: "file not found" (*fs.PathError)`, and
+// a branch of a tree for each of the errors that it joins, with their own
+// causes below them.
+func (h *Handler) errorCauses(err error) []string {
+	return h.appendErrorCauses(nil, err, 0)
+}
+
+func (h *Handler) appendErrorCauses(lines []string, err error, depth int) []string {
+	if depth == maxErrorCauses {
+		return append(lines, h.gray("…"))
+	}
+	errs, ok := joinedErrors(err)
+	if !ok {
+		cause := errors.Unwrap(err)
+		if cause == nil {
+			return lines
+		}
+		lines = append(lines, h.gray("caused by:")+" "+h.errorText(cause))
+		return h.appendErrorCauses(lines, cause, depth+1)
+	}
+
+	pipe, tee, elbow := h.connectors()
+	for i, e := range errs {
+		branch, indent := tee, pipe
+		if i == len(errs)-1 {
+			branch, indent = elbow, connectorBlank
+		}
+		lines = append(lines, h.gray(branch)+h.errorText(e))
+		for _, line := range h.appendErrorCauses(nil, e, depth+1) {
+			lines = append(lines, h.gray(indent)+line)
+		}
+	}
+	return lines
+}
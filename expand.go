@@ -0,0 +1,160 @@
+package devslog
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// expand returns v with the structs and maps that it holds, down to levels
+// levels, turned into groups of their fields and entries, for the
+// ExpandStructs option. The values below that are rendered on a single line,
+// with the names of their fields. Slices and arrays of at least SliceMinLen
+// elements are turned into groups of their elements, at any level, down to
+// maxDepthCount levels below the MaxDepth option, since a slice can hold
+// itself. Deeper slices are rendered as "…".
+func (h *Handler) expand(v slog.Value, levels int) slog.Value {
+	if v.Kind() != slog.KindAny {
+		return v
+	}
+	if attrs, ok := h.expandSlice(v.Any(), levels); ok {
+		if attrs == nil {
+			return slog.StringValue("…")
+		}
+		return slog.GroupValue(attrs...)
+	}
+	if levels <= 0 {
+		return v
+	}
+	rv, ok := expandable(v.Any())
+	if !ok {
+		return v
+	}
+
+	var attrs []slog.Attr
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		for i := range t.NumField() {
+			if f := t.Field(i); f.IsExported() {
+				attrs = append(attrs, h.expandAttr(f.Name, rv.Field(i).Interface(), levels-1))
+			}
+		}
+	case reflect.Map:
+		// Keys such as NaN can't be looked up, so the entries are collected
+		// rather than the keys.
+		var entries [][2]reflect.Value
+		for iter := rv.MapRange(); iter.Next(); {
+			entries = append(entries, [2]reflect.Value{iter.Key(), iter.Value()})
+		}
+		slices.SortFunc(entries, func(a, b [2]reflect.Value) int { return compareMapKeys(a[0], b[0]) })
+		for _, e := range entries {
+			attrs = append(attrs, h.expandAttr(fmt.Sprint(e[0].Interface()), e[1].Interface(), levels-1))
+		}
+	}
+	if len(attrs) == 0 {
+		return v
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// expandValue is expand with the levels of the ExpandStructs option. If walking
+// the value panics, it returns the placeholder of formatPanic instead, as
+// recoverValue does while the value is written.
+func (h *Handler) expandValue(v slog.Value) (ev slog.Value) {
+	defer func() {
+		if p := recover(); p != nil {
+			ev = slog.AnyValue(panicFormatted(p))
+		}
+	}()
+	return h.expand(v, h.opts.ExpandStructs)
+}
+
+// compareMapKeys orders the keys of a map, so that its entries are expanded in
+// the same order on every run: numbers by value, and other keys, or keys of
+// different kinds, by their text, and then by the name of their type.
+func compareMapKeys(a, b reflect.Value) int {
+	if a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	if b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+	var c int
+	switch {
+	case a.CanInt() && b.CanInt():
+		c = cmp.Compare(a.Int(), b.Int())
+	case a.CanUint() && b.CanUint():
+		c = cmp.Compare(a.Uint(), b.Uint())
+	case a.CanFloat() && b.CanFloat():
+		c = cmp.Compare(a.Float(), b.Float())
+	}
+	c = cmp.Or(c, strings.Compare(fmt.Sprint(a), fmt.Sprint(b)))
+	if c != 0 || !a.IsValid() || !b.IsValid() {
+		return c
+	}
+	// Equal keys of different types, such as 3 and int8(3).
+	return strings.Compare(a.Type().String(), b.Type().String())
+}
+
+// expandAttr returns the attribute of a field or an entry with the value x.
+func (h *Handler) expandAttr(key string, x any, levels int) slog.Attr {
+	v := slog.AnyValue(x)
+	if levels <= 0 && h.opts.ExpandStructs > 0 {
+		if _, ok := expandable(x); ok {
+			return slog.String(key, normalizePanics(fmt.Sprintf("%+v", x)))
+		}
+	}
+	return slog.Attr{Key: key, Value: h.expand(v, levels)}
+}
+
+// expandSlice returns the attributes of the elements of x, keyed by their
+// index, if x is a slice or an array of at least SliceMinLen elements.
+// []byte values are left to the hex dump. The attributes are nil when x is too
+// deep to be expanded.
+func (h *Handler) expandSlice(x any, levels int) ([]slog.Attr, bool) {
+	if h.opts.SliceMinLen <= 0 {
+		return nil, false
+	}
+	switch x.(type) {
+	case nil, error, fmt.Stringer, slog.LogValuer:
+		return nil, false
+	}
+	rv := reflect.ValueOf(x)
+	if k := rv.Kind(); (k != reflect.Slice && k != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	if rv.Len() == 0 || rv.Len() < h.opts.SliceMinLen {
+		return nil, false
+	}
+	if h.opts.ExpandStructs-levels >= h.opts.MaxDepth+maxDepthCount {
+		return nil, true
+	}
+	attrs := make([]slog.Attr, rv.Len())
+	for i := range attrs {
+		attrs[i] = h.expandAttr(strconv.Itoa(i), rv.Index(i).Interface(), levels-1)
+	}
+	return attrs, true
+}
+
+// expandable returns the struct or map that x is, or points to. It reports
+// false for the values that render themselves, such as errors and
+// [fmt.Stringer] values.
+func expandable(x any) (reflect.Value, bool) {
+	switch x.(type) {
+	case nil, error, fmt.Stringer, slog.LogValuer:
+		return reflect.Value{}, false
+	}
+	rv := reflect.ValueOf(x)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return reflect.Value{}, false
+		}
+		rv = rv.Elem()
+	}
+	return rv, rv.Kind() == reflect.Struct || rv.Kind() == reflect.Map
+}
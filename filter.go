@@ -0,0 +1,45 @@
+package devslog
+
+import (
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// filtered reports whether a, an attribute of groups, is left out by the
+// DropKeys or KeepKeys option. Both match the path of the attribute, the names
+// of its groups and its key joined with dots, as in "req.headers.accept".
+func (h *Handler) filtered(groups []string, a slog.Attr) bool {
+	if a.Key == "" || (len(h.opts.DropKeys) == 0 && len(h.opts.KeepKeys) == 0) {
+		return false
+	}
+	keyPath := strings.Join(append(groups[:len(groups):len(groups)], a.Key), ".")
+	if matchAny(h.opts.DropKeys, keyPath) {
+		return true
+	}
+	if len(h.opts.KeepKeys) == 0 || a.Value.Kind() == slog.KindGroup {
+		// The attributes of groups are kept or left out on their own.
+		return false
+	}
+	if matchAny(h.opts.KeepKeys, keyPath) {
+		return false
+	}
+	// An attribute is kept with the groups that it's in.
+	for i := len(groups); i > 0; i-- {
+		if matchAny(h.opts.KeepKeys, strings.Join(groups[:i], ".")) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether s matches one of patterns, in the syntax of
+// [path.Match].
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package devslog
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+)
+
+// RegisterFlags defines the -log-level, -log-color and -log-time flags in fs,
+// or in [flag.CommandLine] if fs is nil, so that command-line programs get
+// consistent logging flags. It returns the options that the flags set, to be
+// passed to [New] once fs is parsed, and the level of the options, which can
+// also be changed while the program runs.
+//
+// -log-level takes level directives, such as "debug" or "info,db=debug", in
+// the syntax of [ParseLevelDirectives]. -log-color is "auto", "always",
+// "never", or a boolean such as "true" or "false". -log-time is the layout of
+// times, like Options.TimeFormat.
+func RegisterFlags(fs *flag.FlagSet) (*Options, *slog.LevelVar) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	level := new(slog.LevelVar)
+	opts := &Options{HandlerOptions: slog.HandlerOptions{Level: level}}
+
+	fs.Func("log-level", `minimum level of logs, such as "debug" or "info,db=debug"`, func(s string) error {
+		l, groups, err := parseLevelDirectives(s)
+		if err != nil {
+			return err
+		}
+		if l != nil {
+			level.Set(l.Level())
+		}
+		mergeGroupLevels(opts, groups)
+		return nil
+	})
+	fs.Func("log-color", `colors of logs: "auto", "always", "never", "true" or "false"`, func(s string) error {
+		if !setColor(opts, s) {
+			return errors.New("want auto, always, never, true or false")
+		}
+		return nil
+	})
+	fs.StringVar(&opts.TimeFormat, "log-time", "", "layout of the times of logs, such as 15:04:05.000")
+	return opts, level
+}
@@ -0,0 +1,77 @@
+package devslog
+
+import (
+	"bytes"
+	"cmp"
+)
+
+// A FoldStyle selects the markers that log viewers use to fold sections of the
+// output, so that multi-line records can be collapsed.
+type FoldStyle int
+
+const (
+	// FoldNone emits no folding markers.
+	FoldNone FoldStyle = iota
+	// FoldGitHubActions wraps a record in the ::group:: and ::endgroup::
+	// workflow commands. The first line of the record is the group title.
+	FoldGitHubActions
+	// FoldVim appends the {{{ and }}} fold markers to the first and last line
+	// of a record.
+	FoldVim
+)
+
+// fold wraps the lines of a multi-line record in the markers of the FoldStyle
+// option. Records of a single line are returned as-is.
+func (h *Handler) fold(record []byte) []byte {
+	body := bytes.TrimSuffix(record, []byte("\n"))
+	first, rest, multiline := bytes.Cut(body, []byte("\n"))
+	if !multiline {
+		return record
+	}
+
+	var out bytes.Buffer
+	switch h.opts.FoldStyle {
+	case FoldGitHubActions:
+		_, _ = out.WriteString("::group::")
+		_, _ = out.Write(first)
+		_ = out.WriteByte('\n')
+		_, _ = out.Write(rest)
+		_, _ = out.WriteString("\n::endgroup::\n")
+	case FoldVim:
+		_, _ = out.Write(first)
+		_, _ = out.WriteString(" {{{\n")
+		_, _ = out.Write(rest)
+		_, _ = out.WriteString(" }}}\n")
+	default:
+		return record
+	}
+	return out.Bytes()
+}
+
+// Default markers of the Frame option, and the ones with the ASCII option.
+const (
+	defaultFrameStart = "┌──"
+	defaultFrameEnd   = "└──"
+	asciiFrameStart   = "+--"
+	asciiFrameEnd     = "+--"
+)
+
+// frameMarkers returns the lines that the Frame option writes before and after
+// each record.
+func (h *Handler) frameMarkers() (start, end string) {
+	start, end = h.opts.FrameStart, h.opts.FrameEnd
+	if h.opts.ASCII {
+		return cmp.Or(start, asciiFrameStart), cmp.Or(end, asciiFrameEnd)
+	}
+	return cmp.Or(start, defaultFrameStart), cmp.Or(end, defaultFrameEnd)
+}
+
+// frame wraps a record between the lines of the Frame option.
+func (h *Handler) frame(record []byte) []byte {
+	start, end := h.frameMarkers()
+
+	out := []byte(h.gray(start) + "\n")
+	out = append(out, record...)
+	out = append(out, h.gray(end)+"\n"...)
+	return out
+}
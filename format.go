@@ -0,0 +1,264 @@
+package devslog
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatValue renders the value of an attribute that is not a group.
+func (h *Handler) formatValue(key string, v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindString:
+		return h.truncate(v.String())
+	case slog.KindTime:
+		// Write times in the same layout as the built-in time attribute.
+		return h.formatTime(v.Time())
+	case slog.KindInt64:
+		if h.isByteSize(key) {
+			return h.formatByteSize(v.Int64() < 0, absInt64(v.Int64()))
+		}
+		if s, ok := h.formatID(key, v.Int64() < 0, absInt64(v.Int64())); ok {
+			return s
+		}
+		return h.groupThousands(strconv.FormatInt(v.Int64(), 10))
+	case slog.KindUint64:
+		if h.isByteSize(key) {
+			return h.formatByteSize(false, v.Uint64())
+		}
+		if s, ok := h.formatID(key, false, v.Uint64()); ok {
+			return s
+		}
+		return h.groupThousands(strconv.FormatUint(v.Uint64(), 10))
+	case slog.KindFloat64:
+		return h.formatFloat(v.Float64())
+	case slog.KindDuration:
+		return h.formatDuration(v.Duration())
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case []byte:
+			return h.formatBytes(x)
+		case untruncated:
+			return string(x)
+		case formatted:
+			return h.truncate(x.text)
+		case error, fmt.Stringer:
+			// Call the method here rather than in fmt, which recovers from its
+			// panics on its own, so that recoverValue renders them.
+			if !isNil(v) {
+				return stringify(x)
+			}
+		}
+	}
+	return normalizePanics(v.String())
+}
+
+// stringify returns the text of x like fmt does for %v: the result of its Error
+// method, or else of its String method.
+func stringify(x any) string {
+	if err, ok := x.(error); ok {
+		return err.Error()
+	}
+	return x.(fmt.Stringer).String()
+}
+
+// formatted is a value rendered by the KeyFormats or ValueFormatters option.
+type formatted struct {
+	text  string
+	color Color
+}
+
+// customFormat renders the value v of the attribute key with the first of the
+// KeyFormats option that matches key, or else with the first of the
+// ValueFormatters option that knows the type of v.
+func (h *Handler) customFormat(key string, v slog.Value) (formatted, bool) {
+	if v.Kind() == slog.KindGroup {
+		return formatted{}, false
+	}
+	// The value is already formatted when replaceAttr is called again.
+	if _, ok := v.Any().(formatted); ok {
+		return formatted{}, false
+	}
+	for _, f := range h.opts.KeyFormats {
+		if ok, _ := path.Match(f.Key, key); ok && f.Format != nil {
+			return callKeyFormat(f, v), true
+		}
+	}
+	if v.Kind() != slog.KindAny {
+		return formatted{}, false
+	}
+	x := v.Any()
+	for _, f := range h.opts.ValueFormatters {
+		if s, ok := callValueFormatter(f, x); ok {
+			return s, true
+		}
+	}
+	return formatted{}, false
+}
+
+// callKeyFormat calls the Format function of f, a format of the KeyFormats
+// option, with v.
+func callKeyFormat(f KeyFormat, v slog.Value) (s formatted) {
+	var ok bool
+	defer recoverFormat(&s, &ok)
+	text, color := f.Format(v)
+	return formatted{text: text, color: color}
+}
+
+// callValueFormatter calls f, a formatter of the ValueFormatters option, with
+// x.
+func callValueFormatter(f ValueFormatter, x any) (s formatted, ok bool) {
+	defer recoverFormat(&s, &ok)
+	text, ok := f(x)
+	return formatted{text: text}, ok
+}
+
+// recoverFormat, deferred by the calls of the formatters of the caller,
+// renders the placeholder of formatPanic when they panic, as recoverValue does
+// while a value is written.
+func recoverFormat(s *formatted, ok *bool) {
+	if p := recover(); p != nil {
+		*s, *ok = panicFormatted(p), true
+	}
+}
+
+// IDFormat describes how to render large integers, such as snowflake IDs,
+// that are hard to read in decimal.
+type IDFormat struct {
+	// Base is 16, for a hexadecimal value with a "0x" prefix, or 36, for a
+	// value made of the digits 0-9 and the letters a-z.
+	Base int
+
+	// Min is the magnitude from which an integer is rendered in Base.
+	// Smaller integers are rendered in decimal.
+	Min uint64
+
+	// Keys limits the format to the attributes with these keys. If empty,
+	// it applies to every integer attribute.
+	Keys []string
+}
+
+// formatID renders an integer of magnitude n in the base of the IDFormat
+// option. It reports false if the integer should be rendered in decimal.
+func (h *Handler) formatID(key string, negative bool, n uint64) (string, bool) {
+	f := h.opts.IDFormat
+	if f == nil || (f.Base != 16 && f.Base != 36) || n < f.Min {
+		return "", false
+	}
+	if len(f.Keys) > 0 && !slices.Contains(f.Keys, key) {
+		return "", false
+	}
+
+	s := strconv.FormatUint(n, f.Base)
+	if f.Base == 16 {
+		s = "0x" + s
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s, true
+}
+
+// absInt64 returns the magnitude of n, without overflowing for the minimum
+// int64.
+func absInt64(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+// formatFloat renders f with the number of decimals of the FloatPrecision
+// option, or else with the fewest digits that represent it exactly, like
+// [slog.Value.String].
+func (h *Handler) formatFloat(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	if h.opts.FloatPrecision > 0 {
+		return h.groupThousands(strconv.FormatFloat(f, 'f', h.opts.FloatPrecision, 64))
+	}
+	// Digits are only grouped when there's no exponent, which is used by
+	// default for large numbers.
+	if h.opts.ThousandsSeparator != "" && math.Abs(f) < 1e21 {
+		return h.groupThousands(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// durationUnits are the suffixes of the units of the DurationUnit option.
+var durationUnits = map[time.Duration]string{
+	time.Nanosecond:  "ns",
+	time.Microsecond: "µs",
+	time.Millisecond: "ms",
+	time.Second:      "s",
+	time.Minute:      "m",
+	time.Hour:        "h",
+}
+
+// formatDuration renders d in the DurationUnit option, or rounded to three
+// significant digits, as in "1.23s" or "341ms", and to the second from a
+// minute, as in "4m12s".
+func (h *Handler) formatDuration(d time.Duration) string {
+	if suffix, ok := durationUnits[h.opts.DurationUnit]; ok {
+		return h.formatFloat(float64(d)/float64(h.opts.DurationUnit)) + suffix
+	}
+
+	abs := d.Abs()
+	var unit time.Duration
+	switch {
+	case abs < time.Microsecond:
+		return d.String()
+	case abs < time.Millisecond:
+		unit = time.Microsecond
+	case abs < time.Second:
+		unit = time.Millisecond
+	case abs < time.Minute:
+		unit = time.Second
+	default:
+		return d.Round(time.Second).String()
+	}
+	switch {
+	case abs < 10*unit:
+		d = d.Round(unit / 100)
+	case abs < 100*unit:
+		d = d.Round(unit / 10)
+	default:
+		d = d.Round(unit)
+	}
+	return d.String()
+}
+
+// groupThousands inserts the ThousandsSeparator option between each group of
+// three digits of the integer part of s, a decimal number.
+func (h *Handler) groupThousands(s string) string {
+	sep := h.opts.ThousandsSeparator
+	if sep == "" {
+		return s
+	}
+
+	sign := ""
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	}
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i:]
+	}
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, d := range []byte(intPart) {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteByte(d)
+	}
+	b.WriteString(frac)
+	return b.String()
+}
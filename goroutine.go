@@ -0,0 +1,23 @@
+package devslog
+
+import (
+	"bytes"
+	"runtime"
+)
+
+// goroutineID returns the ID of the calling goroutine, parsed from the header
+// of its stack trace, such as "goroutine 18 [running]:". There's no public API
+// for goroutine IDs, so this is a best-effort, development-only feature. It
+// returns an empty string if the ID can't be found.
+func goroutineID() string {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b, ok := bytes.CutPrefix(b, []byte("goroutine "))
+	if !ok {
+		return ""
+	}
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		return string(b[:i])
+	}
+	return ""
+}
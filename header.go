@@ -0,0 +1,176 @@
+package devslog
+
+import (
+	"bytes"
+	"log/slog"
+	"strconv"
+)
+
+// A HeaderField is one of the built-in elements of the first line of a record.
+type HeaderField int
+
+const (
+	// HeaderTime is the time of the record.
+	HeaderTime HeaderField = iota + 1
+	// HeaderLevel is the level of the record.
+	HeaderLevel
+	// HeaderSource is the source location of the record, when the AddSource
+	// option is set.
+	HeaderSource
+	// HeaderMessage is the message of the record.
+	HeaderMessage
+	// HeaderGoroutine is the ID of the goroutine that handled the record, when
+	// the GoroutineID option is set.
+	HeaderGoroutine
+	// HeaderAttrCount is the number of attributes of the record, when the
+	// AttrCount option is set.
+	HeaderAttrCount
+	// HeaderElapsed is the time elapsed since the start of the handler, when
+	// the Elapsed option is set.
+	HeaderElapsed
+)
+
+// defaultHeaderOrder is the order of the first line when Options.HeaderOrder
+// is not set.
+var defaultHeaderOrder = []HeaderField{HeaderTime, HeaderElapsed, HeaderLevel, HeaderGoroutine, HeaderSource, HeaderMessage, HeaderAttrCount}
+
+// appendHeader writes the first line of r, without the trailing newline. The
+// fields are written in the order of the HeaderOrder option and separated by
+// a space. Fields without a value, other than the message, are left out.
+func (h *Handler) appendHeader(buf *bytes.Buffer, r slog.Record) {
+	order := h.opts.HeaderOrder
+	if len(order) == 0 {
+		order = defaultHeaderOrder
+	}
+
+	var written bool
+	for _, field := range order {
+		var s string
+		switch field {
+		case HeaderTime:
+			// From slog handler docs:
+			// 	If r.Time is the zero time, ignore the time.
+			if r.Time.IsZero() {
+				continue
+			}
+			v, ok := h.replaceBuiltin(slog.Time(slog.TimeKey, r.Time))
+			if !ok {
+				continue
+			}
+			if v.Kind() == slog.KindTime {
+				s = h.timestamp(v.Time(), r.Level)
+			} else {
+				s = v.String()
+			}
+			if s != "" {
+				s = h.text(h.opts.Theme.Time, s)
+			}
+		case HeaderElapsed:
+			if h.opts.Elapsed && !r.Time.IsZero() {
+				s = h.text(h.opts.Theme.Time, formatElapsed(r.Time.Sub(h.start)))
+			}
+		case HeaderLevel:
+			v, ok := h.replaceBuiltin(slog.Any(slog.LevelKey, r.Level))
+			if !ok {
+				continue
+			}
+			if level, isLevel := v.Any().(slog.Level); isLevel {
+				s = h.levelText(level)
+			} else {
+				s = h.text(h.levelColour(r.Level), v.String())
+			}
+		case HeaderSource:
+			if !h.opts.AddSource {
+				continue
+			}
+			src := source(r)
+			if src == nil {
+				continue
+			}
+			v, ok := h.replaceBuiltin(slog.Any(slog.SourceKey, src))
+			if !ok {
+				continue
+			}
+			if src, isSource := v.Any().(*slog.Source); isSource {
+				s = h.sourceText(src)
+			} else {
+				s = h.text(h.sourceColour(), v.String())
+			}
+		case HeaderGoroutine:
+			if h.opts.GoroutineID {
+				if id := goroutineID(); id != "" {
+					s = h.text(Magenta, "g"+id)
+				}
+			}
+		case HeaderMessage:
+			v, ok := h.replaceBuiltin(slog.String(slog.MessageKey, r.Message))
+			if !ok {
+				continue
+			}
+			s = v.String()
+			if h.opts.ColorMessage {
+				s = h.text(h.levelColour(r.Level), s)
+			} else {
+				s = h.text(h.opts.Theme.Message, s)
+			}
+		case HeaderAttrCount:
+			if h.opts.AttrCount {
+				s = h.attrCountText(r)
+			}
+		}
+		if s == "" && field != HeaderMessage {
+			continue
+		}
+
+		if written {
+			_ = buf.WriteByte(' ')
+		}
+		_, _ = buf.WriteString(s)
+		written = true
+	}
+}
+
+// replaceBuiltin applies the ReplaceAttr option to a, one of the built-in
+// attributes, and returns its value. It reports false if ReplaceAttr removed
+// the attribute.
+func (h *Handler) replaceBuiltin(a slog.Attr) (slog.Value, bool) {
+	if h.opts.ReplaceAttr == nil {
+		return a.Value, true
+	}
+	a = h.opts.ReplaceAttr(nil, a)
+	return resolve(a.Value), a.Key != ""
+}
+
+// attrCountText returns the badge of the AttrCount option, such as
+// "[7 attrs]", or an empty string if r has no attributes.
+func (h *Handler) attrCountText(r slog.Record) string {
+	var n int
+	for _, lvl := range h.attrLevels(r) {
+		n += countAttrs(lvl.attrs)
+	}
+
+	switch n {
+	case 0:
+		return ""
+	case 1:
+		return h.gray("[1 attr]")
+	default:
+		return h.gray("[" + strconv.Itoa(n) + " attrs]")
+	}
+}
+
+// countAttrs returns the number of attributes in attrs that are not groups,
+// including the ones nested in groups.
+func countAttrs(attrs []slog.Attr) int {
+	var n int
+	for _, a := range attrs {
+		a.Value = resolve(a.Value)
+		switch {
+		case a.Value.Kind() == slog.KindGroup:
+			n += countAttrs(a.Value.Group())
+		case !a.Equal(slog.Attr{}):
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,73 @@
+package devslog
+
+import (
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// hyperlink wraps text in an OSC 8 escape sequence so that terminals which
+// support it make text a link to url. Terminals usually show url on hover.
+func hyperlink(url, text string) string {
+	return "\033]8;;" + url + "\033\\" + text + "\033]8;;\033\\"
+}
+
+// linkURL returns s, the rendered form of v, underlined and as a hyperlink to
+// the URL that v holds, for the URLLinks option. It reports false if v
+// doesn't hold an http or https URL, or if the output doesn't support
+// hyperlinks.
+func (h *Handler) linkURL(v slog.Value, s string) (string, bool) {
+	if !h.opts.URLLinks || !h.hyperlinks {
+		return "", false
+	}
+	var u *url.URL
+	switch v.Kind() {
+	case slog.KindString:
+		// Only the values that are a URL, and not the ones that contain one.
+		str := v.String()
+		if !strings.HasPrefix(str, "http://") && !strings.HasPrefix(str, "https://") {
+			return "", false
+		}
+		var err error
+		if u, err = url.Parse(str); err != nil {
+			return "", false
+		}
+	case slog.KindAny:
+		var ok bool
+		if u, ok = v.Any().(*url.URL); !ok || u == nil {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return hyperlink(u.String(), h.text(Underline, s)), true
+}
+
+// supportsHyperlinks reports whether w is a terminal that's known to support
+// OSC 8 hyperlinks. There's no way to ask the terminal, so this is based on the
+// environment variables set by terminal emulators.
+func supportsHyperlinks(w io.Writer) bool {
+	if !isTerminal(w) {
+		return false
+	}
+
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty", "Hyper":
+		return true
+	}
+	if os.Getenv("WT_SESSION") != "" || os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("DOMTERM") != "" {
+		return true
+	}
+	// VTE based terminals, such as GNOME Terminal, since version 0.50.
+	if v, err := strconv.Atoi(os.Getenv("VTE_VERSION")); err == nil && v >= 5000 {
+		return true
+	}
+	term := os.Getenv("TERM")
+	return strings.Contains(term, "kitty") || strings.Contains(term, "alacritty") || strings.Contains(term, "foot")
+}
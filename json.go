@@ -0,0 +1,112 @@
+package devslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonText returns the JSON document held by v, a string or a
+// [json.RawMessage], for the PrettyJSON option. It reports false if v doesn't
+// hold a JSON object or array, or if it's longer than the MaxValueLen option,
+// so that it's truncated instead.
+func (h *Handler) jsonText(v slog.Value) (string, bool) {
+	if !h.opts.PrettyJSON {
+		return "", false
+	}
+	var s string
+	switch v.Kind() {
+	case slog.KindString:
+		s = v.String()
+	case slog.KindAny:
+		raw, ok := v.Any().(json.RawMessage)
+		if !ok {
+			return "", false
+		}
+		s = string(raw)
+	default:
+		return "", false
+	}
+
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return "", false
+	}
+	if h.opts.MaxValueLen > 0 && utf8.RuneCountInString(s) > h.opts.MaxValueLen {
+		return "", false
+	}
+	return trimmed, json.Valid([]byte(trimmed))
+}
+
+// appendJSON writes an attribute whose value is the JSON document s, indented
+// and colored, as a block below its key.
+func (h *Handler) appendJSON(buf *bytes.Buffer, key, s string, indentLevel int, groups []string, align int) {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(s), "", "  "); err != nil {
+		// s was validated, so this doesn't happen.
+		h.appendKeyVal(buf, key, s, indentLevel, groups, align)
+		return
+	}
+
+	h.appendKeyVal(buf, key, h.gray("|"), indentLevel, groups, align)
+	lines := strings.Split(indented.String(), "\n")
+	for i, line := range lines {
+		lines[i] = h.colorJSON(line)
+	}
+	h.appendBlock(buf, lines, indentLevel)
+}
+
+// colorJSON colors the tokens of line, a line of indented JSON: keys like the
+// keys of attributes, and values like the values of the same kinds with the
+// ColorValues option, even when it's not set.
+func (h *Handler) colorJSON(line string) string {
+	if h.depth == ColorDepthNone {
+		return line
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(line))
+			str := line[i:end]
+			if strings.HasPrefix(strings.TrimLeft(line[end:], " "), ":") {
+				b.WriteString(h.styled(h.keySeq, str))
+			} else {
+				b.WriteString(h.text(h.kindColor(slog.KindString), str))
+			}
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(line) && strings.IndexByte("0123456789.eE+-", line[end]) >= 0 {
+				end++
+			}
+			b.WriteString(h.text(h.kindColor(slog.KindFloat64), line[i:end]))
+			i = end
+		case strings.HasPrefix(line[i:], "true"), strings.HasPrefix(line[i:], "false"):
+			word := "true"
+			if c == 'f' {
+				word = "false"
+			}
+			b.WriteString(h.text(h.kindColor(slog.KindBool), word))
+			i += len(word)
+		case strings.HasPrefix(line[i:], "null"):
+			b.WriteString(h.gray("null"))
+			i += len("null")
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package devslog
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// legend returns the lines that explain the colors and symbols of the output,
+// rendered in the styles they describe.
+func (h *Handler) legend() string {
+	var b strings.Builder
+	entry := func(example, meaning string) {
+		pad := max(legendColumn-visibleWidth(example), 1)
+		fmt.Fprintf(&b, "  %s%s%s\n", example, strings.Repeat(" ", pad), h.gray(meaning))
+	}
+
+	b.WriteString(h.gray("legend:") + "\n")
+	levels := make([]string, 0, 4)
+	for _, l := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+		levels = append(levels, h.levelText(l))
+	}
+	entry(strings.Join(levels, " "), "levels")
+	prefix := h.opts.AttrPrefix
+	switch {
+	case h.opts.TreeConnectors && h.opts.ASCII:
+		prefix = "|-"
+	case h.opts.TreeConnectors:
+		prefix = strings.TrimSpace(connectorTee)
+	}
+	entry(prefix+" "+h.styled(h.keySeq, "key")+h.opts.KeyValueDelimiter+" value", "an attribute of the record")
+	if h.opts.AttrCount {
+		entry(h.gray("[3 attrs]"), "the number of attributes of the record")
+	}
+	if h.opts.TimeDelta {
+		entry(formatDelta(250*time.Millisecond), "the time since the previous record")
+	}
+	if h.opts.Elapsed {
+		entry(h.text(h.opts.Theme.Time, formatElapsed(1234*time.Millisecond)), "the time since the start")
+	}
+	if bar := h.durationBar(h.opts.DurationBarMax * 3 / 8); bar != "" {
+		entry(bar, "a duration relative to "+h.opts.DurationBarMax.String())
+	}
+	return b.String()
+}
+
+// legendColumn is the column of the explanations of the legend.
+const legendColumn = 24
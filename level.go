@@ -0,0 +1,153 @@
+package devslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Levels beyond the ones of the slog package, which the handler displays as
+// "TRACE" and "FATAL".
+const (
+	LevelTrace slog.Level = -8
+	LevelFatal slog.Level = 12
+)
+
+// defaultLevelNames are the names of the levels of this package. The
+// LevelNames option takes precedence.
+var defaultLevelNames = map[slog.Level]string{
+	LevelTrace: "TRACE",
+	LevelFatal: "FATAL",
+}
+
+// FatalExitCode is the exit code of the program after [Fatal] and [Fatalf].
+var FatalExitCode = 1
+
+// exit is replaced in tests.
+var exit = os.Exit
+
+// Fatal logs a record at LevelFatal with the default logger, like [slog.Info]
+// does at its level, flushes the logger's handler if it buffers its output,
+// such as a [Handler], and exits the program with FatalExitCode.
+func Fatal(msg string, args ...any) {
+	fatal(msg, args...)
+}
+
+// Fatalf is like [Fatal], with a message formatted by [fmt.Sprintf].
+func Fatalf(format string, args ...any) {
+	fatal(fmt.Sprintf(format, args...))
+}
+
+// fatal is the implementation of Fatal and Fatalf. It must be called by them
+// directly, so that the source of the record is their caller.
+func fatal(msg string, args ...any) {
+	ctx := context.Background()
+	logger := slog.Default()
+	if logger.Enabled(ctx, LevelFatal) {
+		var pcs [1]uintptr
+		runtime.Callers(3, pcs[:]) // Skip Callers, fatal and Fatal or Fatalf.
+		r := slog.NewRecord(time.Now(), LevelFatal, msg, pcs[0])
+		r.Add(args...)
+		_ = logger.Handler().Handle(ctx, r)
+	}
+	if f, ok := logger.Handler().(flusher); ok {
+		_ = f.Flush()
+	}
+	exit(FatalExitCode)
+}
+
+// minLevel returns the minimum level of the records to handle: the one of the
+// GroupLevels option that applies to the handler, or else the one of the Level
+// option.
+func (h *Handler) minLevel() slog.Level {
+	if h.groupLevel != nil {
+		return h.groupLevel.Level()
+	}
+	return h.opts.Level.Level()
+}
+
+// findGroupLevel returns the level of the GroupLevels option for the longest
+// prefix of the handler's component, or of its groups if it has none, or nil
+// if there's no such level.
+func (h *Handler) findGroupLevel() slog.Leveler {
+	if len(h.opts.GroupLevels) == 0 {
+		return nil
+	}
+	var groups, component []string
+	for _, goa := range h.goas {
+		if goa.group != "" {
+			groups = append(groups, goa.group)
+		}
+		for _, a := range goa.attrs {
+			if h.opts.ComponentKey != "" && a.Key == h.opts.ComponentKey {
+				component = strings.Split(resolve(a.Value).String(), ".")
+			}
+		}
+	}
+	if component != nil {
+		groups = component
+	}
+	for i := len(groups); i > 0; i-- {
+		if level, ok := h.opts.GroupLevels[strings.Join(groups[:i], ".")]; ok && level != nil {
+			return level
+		}
+	}
+	return nil
+}
+
+// Level returns the minimum level of the records to handle, without the
+// GroupLevels option.
+func (h *Handler) Level() slog.Level {
+	return h.opts.Level.Level()
+}
+
+// SetLevel changes the minimum level of the records to handle, for h and the
+// handlers derived from it with WithAttrs and WithGroup, and the ones it was
+// derived from, so that the verbosity of a program can change while it runs.
+// When the Level option is a [*slog.LevelVar], SetLevel sets it, and when it
+// is nil, the handler has a LevelVar of its own. SetLevel does nothing when it
+// is any other [slog.Leveler], which keeps deciding the level. The
+// GroupLevels option still takes precedence.
+func (h *Handler) SetLevel(level slog.Level) {
+	if lv, ok := h.opts.Level.(*slog.LevelVar); ok {
+		lv.Set(level)
+	}
+}
+
+// levelSteps are the levels that stepLevel goes through.
+var levelSteps = []slog.Level{LevelTrace, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError, LevelFatal}
+
+// stepLevel sets the level of the handler to the next level of levelSteps
+// that is more verbose, if verbose is true, or less verbose otherwise, and
+// logs the change at the new level.
+func (h *Handler) stepLevel(verbose bool) {
+	level := h.Level()
+	next := level
+	if verbose {
+		for _, l := range slices.Backward(levelSteps) {
+			if l < level {
+				next = l
+				break
+			}
+		}
+	} else {
+		for _, l := range levelSteps {
+			if l > level {
+				next = l
+				break
+			}
+		}
+	}
+	h.SetLevel(next)
+	if h.Level() != next {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), next, "log level set to "+h.levelName(next), 0)
+	_ = h.Handle(context.Background(), r)
+}
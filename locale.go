@@ -0,0 +1,72 @@
+package devslog
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// localeLayout holds the layouts of the date and the time of a locale.
+type localeLayout struct {
+	date, time string
+}
+
+// localeLayouts are the layouts of the locales supported by the TimeLocale
+// option. Spaces inside a layout are non-breaking, so that a time remains a
+// single field on the first line of a record.
+var localeLayouts = map[string]localeLayout{
+	"en-US": {date: "01/02/2006", time: "3:04:05\u202fPM"},
+	"en-GB": {date: "02/01/2006", time: time.TimeOnly},
+	"de-DE": {date: "02.01.2006", time: time.TimeOnly},
+	"es-ES": {date: "02/01/2006", time: time.TimeOnly},
+	"fr-FR": {date: "02/01/2006", time: time.TimeOnly},
+	"it-IT": {date: "02/01/2006", time: time.TimeOnly},
+	"ja-JP": {date: "2006/01/02", time: time.TimeOnly},
+	"zh-CN": {date: "2006/01/02", time: time.TimeOnly},
+}
+
+// languageLocales map a language to the locale used when only the language
+// matches, as in "en_AU".
+var languageLocales = map[string]string{
+	"en": "en-US",
+	"de": "de-DE",
+	"es": "es-ES",
+	"fr": "fr-FR",
+	"it": "it-IT",
+	"ja": "ja-JP",
+	"zh": "zh-CN",
+}
+
+// lookupLocale returns the layouts of locale, which may be written as a BCP 47
+// tag, "de-DE", or as a POSIX locale, "de_DE.UTF-8". The special value
+// "system" reads the locale from the LC_ALL, LC_TIME and LANG environment
+// variables. It reports false for unknown locales.
+func lookupLocale(locale string) (localeLayout, bool) {
+	if locale == "system" {
+		locale = systemLocale()
+	}
+
+	// Normalize "de_DE.UTF-8@euro" to "de-DE".
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	lang, region, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	lang = strings.ToLower(lang)
+	if region != "" {
+		if l, ok := localeLayouts[lang+"-"+strings.ToUpper(region)]; ok {
+			return l, true
+		}
+	}
+	l, ok := localeLayouts[languageLocales[lang]]
+	return l, ok
+}
+
+// systemLocale returns the locale of the environment, following the same
+// precedence as the C library.
+func systemLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,572 @@
+package devslog
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Options configure a [Handler]. It embeds [slog.HandlerOptions] so that the
+// standard options are available alongside the ones specific to this package.
+// The zero value produces the same output as [NewHandler] with nil options.
+type Options struct {
+	slog.HandlerOptions
+
+	// NoColor disables colors and other escape sequences, such as
+	// hyperlinks, in the output.
+	NoColor bool
+
+	// ForceColor enables colors even when the handler doesn't write to a
+	// terminal, such as when the output is piped, and regardless of the
+	// environment variables that disable colors. NoColor takes precedence.
+	ForceColor bool
+
+	// ColorDepth is the number of colors of the terminal. By default, it's
+	// detected from environment variables such as COLORTERM and TERM, and colors
+	// are disabled when the handler doesn't write to a terminal. Colors are
+	// converted to the closest ones available at the depth.
+	ColorDepth ColorDepth
+
+	// IgnoreColorEnv makes the handler ignore the NO_COLOR, CLICOLOR,
+	// CLICOLOR_FORCE and FORCE_COLOR environment variables, which otherwise
+	// disable or force colors when ColorDepth is detected.
+	IgnoreColorEnv bool
+
+	// SourceFunc adds the name of the function to the source location shown
+	// when AddSource is set, as in "main.run@cmd/main.go:42".
+	SourceFunc bool
+
+	// SourceLinks makes the source location shown when AddSource is set a
+	// clickable OSC 8 hyperlink to the file. Hyperlinks are only emitted when
+	// the output is a terminal known to support them and colors are enabled.
+	SourceLinks bool
+
+	// SourceURLTemplate is the format of the SourceLinks URL. It's passed to
+	// [fmt.Sprintf] with the absolute path of the file and the line number,
+	// such as "vscode://file/%s:%d". The default is a file:// URL, without the
+	// line number.
+	SourceURLTemplate string
+
+	// URLLinks makes the values that are http or https URLs, as strings or
+	// [*url.URL], underlined, clickable OSC 8 hyperlinks. Like SourceLinks,
+	// they're only emitted when the output supports them.
+	URLLinks bool
+
+	// StackTraceLevel, if set, adds the stack trace of the call that logs a
+	// record at or above this level, such as [slog.LevelError], below its
+	// attributes, so that it's clear where the record came from.
+	StackTraceLevel slog.Leveler
+
+	// HeaderOrder is the order of the built-in fields on the first line of
+	// each record. Fields that are not listed are not shown. The default is
+	// HeaderTime, HeaderLevel, HeaderGoroutine, HeaderSource, HeaderMessage,
+	// HeaderAttrCount.
+	HeaderOrder []HeaderField
+
+	// GoroutineID shows the ID of the goroutine that logged each record on
+	// its first line, such as "g18", which helps when debugging concurrency
+	// issues. Go has no public API for goroutine IDs, so it's parsed from a
+	// stack trace on each record: only use this in development.
+	GoroutineID bool
+
+	// AttrCount shows the number of attributes of each record on its first
+	// line, such as "[7 attrs]". Attributes nested in groups are counted, but
+	// not the groups themselves.
+	AttrCount bool
+
+	// LevelNames maps levels to the names displayed for them, which is
+	// mostly useful for custom levels, such as slog.Level(-8) to "TRACE".
+	// Levels without a name are displayed as [slog.Level.String] does.
+	LevelNames map[slog.Level]string
+
+	// LevelColors maps levels to the colors of their names, overriding the
+	// default colors and the theme. Levels that are not in the map take the
+	// color of the closest level below them, so a color for slog.LevelError
+	// also applies to slog.LevelError+4.
+	LevelColors map[slog.Level]Color
+
+	// Theme sets the colors of the elements of the output.
+	Theme Theme
+
+	// ColorMessage colors the message of each record like the name of its
+	// level, so that, for example, error messages stand out.
+	ColorMessage bool
+
+	// ColorValues colors the values of attributes by their kind, so that,
+	// for example, numbers stand out from strings. Keys remain gray.
+	ColorValues bool
+
+	// ValueMarkers makes booleans and nil values easy to tell apart: true is
+	// green, false is red, and nil values, including nil pointers, are
+	// rendered as a gray, italic "<nil>". Without colors, they're rendered as
+	// usual.
+	ValueMarkers bool
+
+	// KindColors maps kinds of values to their colors when ColorValues is
+	// set, overriding the default colors.
+	KindColors map[slog.Kind]Color
+
+	// StyleRules style whole records based on the value of a boolean
+	// attribute, such as dimming the records with "cached" set to true. The
+	// first matching rule wins. Rules are ignored when colors are disabled.
+	StyleRules []StyleRule
+
+	// Compact renders each record on a single line, with the attributes
+	// following the message as key=value pairs. Groups are flattened into
+	// dotted keys, such as "req.method=GET".
+	Compact bool
+
+	// InlineMaxAttrs renders the records with up to this many attributes on
+	// a single line, as the Compact option does, while larger records keep
+	// one attribute per line. Attributes in groups count individually.
+	InlineMaxAttrs int
+
+	// AttrPrefix is the symbol before the key of each attribute. The default
+	// is "↳".
+	AttrPrefix string
+
+	// KeyValueDelimiter separates the key of each attribute from its value.
+	// The default is ":".
+	KeyValueDelimiter string
+
+	// ASCII uses only ASCII characters for the attribute prefix, "->", the
+	// key-value delimiter, " =", the guides of TreeGuides and the lines of
+	// DateBanner, Frame and batches, for terminals and log viewers that can't
+	// show the defaults. AttrPrefix, KeyValueDelimiter, FrameStart and
+	// FrameEnd take precedence.
+	ASCII bool
+
+	// SortAttrs sorts the attributes of each group, and of the top level of
+	// each record, by key, so that the output is easy to compare between
+	// runs. Otherwise, attributes keep the order in which they were added.
+	SortAttrs bool
+
+	// AlignKeys pads the keys of the attributes of each group, and of the top
+	// level of each record, to a common width, so that their values line up
+	// in a column.
+	AlignKeys bool
+
+	// Indent is the indentation of each level of groups, such as "  " to
+	// keep deeply nested groups within narrow terminals, or "\t". The
+	// default is four spaces. It's ignored by TreeGuides, except for the
+	// continuation lines of values.
+	Indent string
+
+	// TreeGuides draws a vertical line below each group, down to its last
+	// attribute, so that the attributes of the record, and of the groups
+	// opened with WithGroup, read as a tree rooted at the message.
+	TreeGuides bool
+
+	// TreeConnectors draws the attributes as a tree, with ├─ and └─ before
+	// each attribute and │ below the groups that have more attributes, which
+	// makes deeply nested groups easy to scan. It takes precedence over
+	// TreeGuides, Indent and AttrPrefix.
+	TreeConnectors bool
+
+	// FlattenGroups renders the key of each attribute as the path of its
+	// groups, such as "db.conn.timeout", instead of indenting the attributes
+	// under their groups.
+	FlattenGroups bool
+
+	// GroupSeparator joins the names of groups to the keys of their
+	// attributes when they are flattened, by FlattenGroups or in compact
+	// mode. The default is ".".
+	GroupSeparator string
+
+	// JSONPathKeys renders the key of each attribute as a jq-style path from
+	// the root of the record, such as `.request.headers["Content-Type"]`,
+	// instead of indenting the attributes under their groups. Keys that are
+	// not identifiers are quoted in brackets.
+	JSONPathKeys bool
+
+	// DedupeKeys removes the attributes whose key is repeated later on in the
+	// same group, so that the last one wins, as in many JSON handlers. The
+	// attributes added with WithAttrs and the record's attributes are part of
+	// the same group when no group was opened between them. Each group value
+	// is deduplicated independently.
+	DedupeKeys bool
+
+	// KeyPrefix is removed from the start of the keys of attributes and the
+	// names of groups, when they share a namespace such as "app.http.". The
+	// prefix is matched against each key, not against the path of groups
+	// leading to it. Keys without the prefix, or that are equal to it, are
+	// shown in full. A line mentioning the prefix is written before the
+	// first record.
+	KeyPrefix string
+
+	// MaxValueLen is the maximum number of runes of a string value that are
+	// displayed. Longer values are truncated, and followed by an ellipsis and
+	// their length in bytes, such as "…(4096 bytes)". Zero means unlimited.
+	MaxValueLen int
+
+	// SQLKeys are the keys of the attributes whose string values are SQL
+	// queries, such as "query" or "sql". They are rendered with a line for
+	// each clause and with their keywords highlighted. Queries longer than
+	// MaxValueLen are truncated instead.
+	SQLKeys []string
+
+	// PrettyJSON renders the string and [json.RawMessage] values that hold a
+	// JSON object or array indented, and colored, in a block below their key.
+	// Documents longer than MaxValueLen are truncated instead.
+	PrettyJSON bool
+
+	// DropKeys are patterns of the paths of the attributes, and groups, that
+	// are left out, such as the noisy attributes added by shared middleware.
+	// The path of an attribute is the names of its groups and its key joined
+	// with dots, as in "req.headers.accept". Patterns are in the syntax of
+	// [path.Match].
+	DropKeys []string
+
+	// KeepKeys, if not empty, are patterns of the paths of the only
+	// attributes that are shown, like DropKeys, which takes precedence. The
+	// attributes of a group that matches are all shown.
+	KeepKeys []string
+
+	// RedactKeys are patterns of the keys of the attributes, and groups,
+	// whose values are hidden as set by RedactMode, so that credentials don't
+	// leak when logs are shared. They are in the syntax of [path.Match], and
+	// are matched regardless of case. [DefaultRedactKeys] covers the common
+	// credentials.
+	RedactKeys []string
+
+	// RedactMode determines what replaces the values hidden by RedactKeys
+	// and MaskPatterns. The default is RedactHide.
+	RedactMode RedactMode
+
+	// MaskPatterns mask the parts of string values that match regular
+	// expressions, such as the credit card numbers, bearer tokens and email
+	// addresses of [DefaultMaskPatterns].
+	MaskPatterns []MaskPattern
+
+	// KeyFormats render the values of the attributes with particular keys.
+	// The first one whose key matches is used. They take precedence over
+	// ValueFormatters, and the other ways of rendering values, other than
+	// MaxValueLen.
+	KeyFormats []KeyFormat
+
+	// ValueFormatters render the values passed with [slog.Any] of the types
+	// that they know, so that they don't need a LogValue method. The first
+	// one that reports true for a value is used. They take precedence over
+	// the other ways of rendering values, other than MaxValueLen.
+	ValueFormatters []ValueFormatter
+
+	// ExpandStructs is the number of levels of the structs and maps, passed
+	// with [slog.Any], that are rendered like groups, with a line for each of
+	// their exported fields and entries. The ones below that are rendered on
+	// a single line, with the names of their fields. Errors and values that
+	// implement [fmt.Stringer] are not expanded. Zero disables it.
+	ExpandStructs int
+
+	// SliceMinLen, if positive, is the number of elements from which slices
+	// and arrays, other than []byte, are rendered like groups, with a line
+	// for each element, keyed by its index.
+	SliceMinLen int
+
+	// MaxDepth is the maximum number of levels of nested groups, including
+	// the ones opened with WithGroup. The groups below that are summarized,
+	// as in "… (3 more levels)", which protects against the deep nesting of
+	// some LogValuers. Zero means unlimited.
+	MaxDepth int
+
+	// TruncateMode determines which part of a value longer than MaxValueLen
+	// is cut. The default is TruncateTail.
+	TruncateMode TruncateMode
+
+	// IDFormat renders large integers, such as snowflake IDs, in hexadecimal
+	// or base 36 instead of decimal. See [IDFormat] for the details.
+	IDFormat *IDFormat
+
+	// ByteSizeKeys are the keys of the integer attributes that are sizes in
+	// bytes, such as "size" or "*_bytes", in the syntax of [path.Match]. They
+	// are rendered in binary units, followed by the number of bytes, as in
+	// "1.4 MiB (1468006)". They take precedence over IDFormat.
+	ByteSizeKeys []string
+
+	// ThousandsSeparator, if set, is inserted between each group of three
+	// digits of the integer part of numbers, as in "1,073,741,824". It's not
+	// applied to the integers rendered by IDFormat.
+	ThousandsSeparator string
+
+	// FloatPrecision, if positive, is the number of decimals of floats.
+	// Otherwise, floats are rendered with the fewest digits that represent
+	// them exactly. NaN and infinities are always rendered as "NaN", "+Inf"
+	// and "-Inf".
+	FloatPrecision int
+
+	// DurationUnit renders durations as a number of this unit, such as
+	// "1234.5ms" for [time.Millisecond], so that they are easy to compare and
+	// sort. It's one of the units of the time package, from [time.Nanosecond]
+	// to [time.Hour]. Otherwise, durations are rounded to three significant
+	// digits in the unit that suits them, as in "1.23s" or "341ms", and to the
+	// second from a minute, as in "4m12s".
+	DurationUnit time.Duration
+
+	// HexDumpMinLen is the length from which []byte values are rendered as a
+	// hex dump, with offsets and an ASCII column, below their key. Shorter
+	// values are rendered as a single hexadecimal string. The default is 16.
+	HexDumpMinLen int
+
+	// HexDumpMaxLen is the number of bytes shown by hex dumps. The others are
+	// only counted. The default is 512, and a negative value shows them all.
+	HexDumpMaxLen int
+
+	// Base64Bytes renders the []byte values that are shorter than
+	// HexDumpMinLen in base64 instead of hexadecimal.
+	Base64Bytes bool
+
+	// DurationBarMax shows a bar next to duration values, whose length is
+	// proportional to the value relative to DurationBarMax, to give a sense
+	// of scale to latencies. Bars are not shown when it's zero, when colors
+	// are disabled, or in compact mode.
+	DurationBarMax time.Duration
+
+	// ShowDate includes the date in the time of each record and in
+	// time-valued attributes, as in "2009-11-09T23:00:00", which helps with
+	// processes that run for days.
+	ShowDate bool
+
+	// DateBanner writes a line with the date, as in "── 2009-11-10 ──",
+	// before a record whose day differs from the day of the previous record,
+	// as an alternative to ShowDate that keeps the first lines short.
+	DateBanner bool
+
+	// TimeFormat is the layout of times, such as [time.Kitchen], which takes
+	// precedence over ShowDate and TimeLocale. Layouts without spaces keep
+	// the time a single field on the first line.
+	TimeFormat string
+
+	// TimeFormatter formats times in place of a layout, for full control,
+	// such as Unix timestamps. It takes precedence over TimeFormat, and is
+	// applied to the time of each record and to time-valued attributes.
+	TimeFormatter func(time.Time) string
+
+	// TimeZone is the location in which times are shown, such as [time.UTC]
+	// or [time.Local]. When it's nil, times are shown in the location they
+	// carry, which may differ between the sources of records.
+	TimeZone *time.Location
+
+	// ShowTimeZone appends the abbreviation of the time zone to times, as in
+	// "23:00:00 UTC".
+	ShowTimeZone bool
+
+	// TimePrecision is the number of digits of the fractions of a second in
+	// times, up to 9, as in "23:00:00.123" for 3. It's ignored when
+	// TimeFormat is set, since the layout can include them.
+	TimePrecision int
+
+	// TimeLocale formats times the way that is customary in a locale, such
+	// as "en-US" or "de_DE.UTF-8". The special value "system" uses the locale
+	// of the environment, from LC_ALL, LC_TIME or LANG. Only a set of common
+	// locales is known; unknown locales use the default layout.
+	TimeLocale string
+
+	// TimeDelta replaces the time on the first line of each record with the
+	// duration since the previous record handled by this handler, or any
+	// handler derived from it, such as "+250ms". The first record still shows
+	// the time.
+	TimeDelta bool
+
+	// TimeDeltaThreshold hides the deltas shorter than the threshold when
+	// TimeDelta is set, so that only meaningful pauses stand out. The zero
+	// value shows every delta.
+	TimeDeltaThreshold time.Duration
+
+	// TimeDeltaInterval shows the time instead of the delta when TimeDelta is
+	// set and at least this long has passed since the time was last shown,
+	// so that the output can still be placed in time. The zero value only
+	// shows the time of the first record.
+	TimeDeltaInterval time.Duration
+
+	// TimeDeltaLevel shows the time instead of the delta when TimeDelta is
+	// set for records at or above this level, such as [slog.LevelWarn], so
+	// that problems are easy to correlate with other sources. When it's nil,
+	// the level doesn't matter.
+	TimeDeltaLevel slog.Leveler
+
+	// Elapsed shows on the first line of each record the time elapsed since
+	// the handler was created, or since ElapsedStart, such as "T+1.234s",
+	// which helps with profiling the startup of programs. To show it instead
+	// of the time, leave HeaderTime out of HeaderOrder.
+	Elapsed bool
+
+	// ElapsedStart is the time from which the Elapsed option counts. The zero
+	// value is the time when the handler was created. Times from [time.Now]
+	// make the elapsed times monotonic.
+	ElapsedStart time.Time
+
+	// TimeHover attaches the absolute time of the record to a relative time
+	// on the first line, such as the one shown by TimeDelta, so that it's
+	// shown when hovering over it. This uses OSC 8 hyperlinks, which are only
+	// emitted when the output is a terminal known to support them. Otherwise,
+	// only the relative time is shown.
+	TimeHover bool
+
+	// FoldStyle wraps each record that spans multiple lines in the folding
+	// markers of a log viewer, so that it can be collapsed there. The default
+	// is FoldNone.
+	FoldStyle FoldStyle
+
+	// Frame writes a marker line before and after each record, so that tools
+	// processing captured output, such as from tmux's capture-pane, can split
+	// it into records reliably.
+	Frame bool
+
+	// FrameStart and FrameEnd are the marker lines of the Frame option. They
+	// default to "┌──" and "└──", or "+--" with the ASCII option.
+	FrameStart, FrameEnd string
+
+	// SidebarKeys lists the keys of attributes, such as trace or request IDs,
+	// that are shown in a right-aligned column at the end of the first line
+	// of each record, instead of with the other attributes. Only attributes
+	// added with WithAttrs or to the record itself are considered; the
+	// attributes of group values are not. The sidebar is only shown when the
+	// width of the output is known, otherwise these attributes are rendered
+	// like any other.
+	SidebarKeys []string
+
+	// SidebarWidth is the number of columns reserved for the sidebar. Longer
+	// content is truncated. The default is 32.
+	SidebarWidth int
+
+	// LevelRoutes send records to writers other than the one passed to the
+	// constructor, based on their level. A record is written to the writer of
+	// the route with the highest Level that is at most the record's level.
+	// Records below every route's Level use the handler's writer. All of the
+	// writers share the handler's lock, so they may be the same writer.
+	LevelRoutes []LevelRoute
+
+	// GroupRoutes send the records of subsystems to writers of their own. A
+	// subsystem is identified by the first group opened with WithGroup, as in
+	// logger.WithGroup("db"). Its records are written to the writer of each
+	// matching route, and to the handler's writer unless a route is
+	// Exclusive. All of the writers share the handler's lock.
+	GroupRoutes []GroupRoute
+
+	// GroupLevels maps the paths of groups opened with WithGroup, their names
+	// joined with dots, as in "db" or "db.pool", to the minimum levels of
+	// their records, overriding the Level option. The longest path that
+	// starts the groups of a handler applies to it, so that a noisy
+	// subsystem can be tuned on its own.
+	GroupLevels map[string]slog.Leveler
+
+	// ComponentKey is the key of the attribute, added with WithAttrs or
+	// [slog.Logger.With], that names the component of a logger, such as
+	// "component" or "logger". When a handler has one, its value, rather
+	// than the path of its groups, chooses the level of GroupLevels.
+	ComponentKey string
+
+	// LevelEnv is the name of an environment variable, such as
+	// "DEVSLOG_LEVEL", that holds level directives in the syntax of
+	// [ParseLevelDirectives]. They are applied over Level and GroupLevels
+	// when the handler is created, and ignored if they are invalid.
+	LevelEnv string
+
+	// ContextExtractors are called by Handle with the context passed to it.
+	// The attributes they return are added after the record's own attributes,
+	// in the order of the extractors, and are rendered the same way. For
+	// example, they are placed in the groups opened by WithGroup. Extractors
+	// may return nil.
+	ContextExtractors []ContextExtractor
+
+	// Wrap breaks attribute values that don't fit in the width of the output
+	// over several lines, preferably at spaces. The continuation lines are
+	// indented under the attribute. It has no effect when the width of the
+	// output is unknown.
+	Wrap bool
+
+	// Legend writes a legend before the first record, which explains the
+	// colors of the levels and the symbols of the output, rendered in the
+	// same styles. Only the symbols of the enabled options are explained.
+	Legend bool
+
+	// AsyncBuffer, if positive, makes Handle queue the formatted records,
+	// up to this many, instead of writing them itself. A single goroutine
+	// writes them in order, so that Handle doesn't wait for a slow writer
+	// while the queue has room. It doesn't make logging itself faster, since
+	// queuing a record costs about as much as writing it to a fast writer.
+	// Handle blocks while the queue is full. The errors of the writes are
+	// returned by [Handler.Close], which must be called before the program
+	// exits so that no queued record is lost.
+	AsyncBuffer int
+
+	// Width is the number of columns of the output. If zero, it's detected
+	// from the terminal that the handler writes to, or from the COLUMNS
+	// environment variable, when a feature needs it. The width of a terminal
+	// is detected again for each record, so the output follows resizes.
+	Width int
+}
+
+// A ValueFormatter renders the values of the types that it knows, such as
+// UUIDs or decimals. It reports false for the other values.
+type ValueFormatter func(v any) (string, bool)
+
+// A KeyFormat renders the values of the attributes with a key, such as the
+// status of HTTP responses, colored by their class:
+//
+//	devslog.KeyFormat{Key: "status", Format: func(v slog.Value) (string, devslog.Color) {
+//		if v.Int64() >= 500 {
+//			return v.String(), devslog.Red
+//		}
+//		return v.String(), devslog.Green
+//	}}
+type KeyFormat struct {
+	// Key is the key of the attributes, or a pattern of keys in the syntax
+	// of [path.Match], such as "*_status".
+	Key string
+	// Format returns the text of a value, and its color. An empty color
+	// leaves the text uncolored.
+	Format func(v slog.Value) (string, Color)
+}
+
+// A ContextExtractor returns request-scoped attributes, such as trace or user
+// IDs, stored in ctx.
+type ContextExtractor func(ctx context.Context) []slog.Attr
+
+// New creates a handler that writes to w, configured by opts, which are
+// applied in order. An [*Options] sets every option at once, so it's usually
+// passed first, if at all; a nil *Options stands for the defaults. The
+// functions such as [WithLevel] set a single option.
+func New(w io.Writer, opts ...Option) *Handler {
+	var o Options
+	for _, opt := range opts {
+		if opt != nil {
+			opt.apply(&o)
+		}
+	}
+	return newHandler(w, o)
+}
+
+// An Option configures the handler created by [New].
+type Option interface {
+	apply(*Options)
+}
+
+// apply replaces all of the options with o, unless o is nil.
+func (o *Options) apply(opts *Options) {
+	if o != nil {
+		*opts = *o
+	}
+}
+
+// optionFunc is an Option that sets a single option.
+type optionFunc func(*Options)
+
+func (f optionFunc) apply(opts *Options) { f(opts) }
+
+// WithLevel sets the minimum level of the records to handle. See
+// [slog.HandlerOptions.Level].
+func WithLevel(level slog.Leveler) Option {
+	return optionFunc(func(opts *Options) { opts.Level = level })
+}
+
+// WithTimeFormat sets the layout of times. See Options.TimeFormat.
+func WithTimeFormat(layout string) Option {
+	return optionFunc(func(opts *Options) { opts.TimeFormat = layout })
+}
+
+// WithColor enables or disables colors. Disabling them is the same as setting
+// Options.NoColor.
+func WithColor(enabled bool) Option {
+	return optionFunc(func(opts *Options) { opts.NoColor = !enabled })
+}
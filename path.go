@@ -0,0 +1,46 @@
+package devslog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// jsonPath returns a jq-style path to key within groups, such as
+// `.request.headers["Content-Type"]`. Segments that are not valid identifiers
+// are quoted in brackets.
+func jsonPath(groups []string, key string) string {
+	var b strings.Builder
+	for _, seg := range groups {
+		appendPathSegment(&b, seg)
+	}
+	appendPathSegment(&b, key)
+	return b.String()
+}
+
+func appendPathSegment(b *strings.Builder, seg string) {
+	if isIdentifier(seg) {
+		b.WriteString("." + seg)
+		return
+	}
+	if b.Len() == 0 {
+		b.WriteByte('.')
+	}
+	b.WriteString("[" + strconv.Quote(seg) + "]")
+}
+
+// isIdentifier reports whether s can be used as-is after a dot in a jq path.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+package devslog
+
+import "strings"
+
+// displayKey returns key as it's rendered, without the KeyPrefix option.
+func (h *Handler) displayKey(key string) string {
+	if h.opts.KeyPrefix == "" {
+		return key
+	}
+	if stripped := strings.TrimPrefix(key, h.opts.KeyPrefix); stripped != "" {
+		return stripped
+	}
+	return key
+}
+
+// displayKeys returns the names of groups as displayed.
+func (h *Handler) displayKeys(groups []string) []string {
+	if h.opts.KeyPrefix == "" {
+		return groups
+	}
+	out := make([]string, len(groups))
+	for i, g := range groups {
+		out[i] = h.displayKey(g)
+	}
+	return out
+}
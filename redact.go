@@ -0,0 +1,90 @@
+package devslog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the values of the attributes matched by the RedactKeys
+// option.
+const redacted = "[REDACTED]"
+
+// A RedactMode determines what replaces the values hidden by the RedactKeys
+// and MaskPatterns options.
+type RedactMode int
+
+const (
+	// RedactHide replaces values with "[REDACTED]".
+	RedactHide RedactMode = iota
+	// RedactHash replaces values with a prefix of their SHA-256 hash, such as
+	// "[sha256:2bb80d53]", so that equal values can be matched across records
+	// without being shown.
+	RedactHash
+)
+
+// redact returns the replacement of the hidden value s.
+func (h *Handler) redact(s string) string {
+	if h.opts.RedactMode != RedactHash {
+		return redacted
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "[sha256:" + hex.EncodeToString(sum[:4]) + "]"
+}
+
+// DefaultRedactKeys are patterns of the keys of common credentials, for the
+// RedactKeys option.
+var DefaultRedactKeys = []string{
+	"*password*", "*passwd*", "*secret*", "*token*", "authorization",
+	"cookie", "set-cookie", "*api_key*", "*apikey*", "*private_key*",
+}
+
+// isRedacted reports whether key matches one of the RedactKeys option,
+// regardless of case.
+func (h *Handler) isRedacted(key string) bool {
+	if key == "" || len(h.opts.RedactKeys) == 0 {
+		return false
+	}
+	key = strings.ToLower(key)
+	for _, pattern := range h.opts.RedactKeys {
+		if ok, _ := path.Match(strings.ToLower(pattern), key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// A MaskPattern masks the parts of string values that match a regular
+// expression, such as credit card numbers or bearer tokens.
+type MaskPattern struct {
+	// Pattern matches the parts of values to mask.
+	Pattern *regexp.Regexp
+	// Replace returns the replacement of a match. If it's nil, matches are
+	// replaced as set by the RedactMode option.
+	Replace func(match string) string
+}
+
+// DefaultMaskPatterns mask credit card numbers, bearer tokens and email
+// addresses, for the MaskPatterns option.
+var DefaultMaskPatterns = []MaskPattern{
+	{Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)},
+	{Pattern: regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9._~+/-]+=*`)},
+	{Pattern: regexp.MustCompile(`\b[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}\b`)},
+}
+
+// mask applies the MaskPatterns option to s.
+func (h *Handler) mask(s string) string {
+	for _, m := range h.opts.MaskPatterns {
+		if m.Pattern == nil {
+			continue
+		}
+		replace := m.Replace
+		if replace == nil {
+			replace = h.redact
+		}
+		s = m.Pattern.ReplaceAllStringFunc(s, replace)
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package devslog
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// maxLogValues is the number of times that resolve calls LogValue before
+// giving up, like [slog.Value.Resolve] does.
+const maxLogValues = 100
+
+// resolvePanic is the value of an attribute whose LogValue method panicked.
+type resolvePanic struct {
+	v any
+}
+
+func (p resolvePanic) String() string {
+	return fmt.Sprintf("<PANIC in LogValue: %v>", p.v)
+}
+
+// resolve is like [slog.Value.Resolve], but if a LogValue method panics, the
+// returned value holds the panic value, as a resolvePanic, so that it can be
+// rendered on a single line with the rest of the record.
+func resolve(v slog.Value) (rv slog.Value) {
+	if v.Kind() != slog.KindLogValuer {
+		return v
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rv = slog.AnyValue(resolvePanic{v: p})
+		}
+	}()
+
+	for range maxLogValues {
+		if v.Kind() != slog.KindLogValuer {
+			return v
+		}
+		v = v.LogValuer().LogValue()
+	}
+	// Let slog produce its error for a LogValuer that never resolves.
+	return v.Resolve()
+}
+
+// formatPanic returns the placeholder of a value whose String, Error or other
+// method panicked while it was being rendered.
+func formatPanic(p any) string {
+	return fmt.Sprintf("!PANIC formatting value: %v", p)
+}
+
+// fmtPanic matches the text that fmt writes for a method that panicked, such
+// as "%!v(PANIC=String method: boom)".
+var fmtPanic = regexp.MustCompile(`%!\w\(PANIC=\w+ method: (.*?)\)`)
+
+// normalizePanics replaces the text that fmt writes in s for the methods that
+// panicked, such as the String methods of the fields of a struct, with the
+// placeholder of formatPanic.
+func normalizePanics(s string) string {
+	if !strings.Contains(s, "(PANIC=") {
+		return s
+	}
+	return fmtPanic.ReplaceAllString(s, formatPanic("$1"))
+}
+
+// valueString is like [slog.Value.String], but with the placeholder of
+// formatPanic for the methods of the value that panic.
+func valueString(v slog.Value) (s string) {
+	defer func() {
+		if p := recover(); p != nil {
+			s = formatPanic(p)
+		}
+	}()
+	if v.Kind() == slog.KindAny && !isNil(v) {
+		switch x := v.Any().(type) {
+		case error, fmt.Stringer:
+			return stringify(x)
+		}
+	}
+	return normalizePanics(v.String())
+}
+
+// panicFormatted is the placeholder of a value whose rendering panicked before
+// it was written, colored like errors.
+func panicFormatted(p any) formatted {
+	return formatted{text: formatPanic(p), color: colourRed}
+}
+
+// recoverValue, deferred by appendAttr, recovers from a panic while the value
+// of the attribute key was being rendered from start in buf, and renders a
+// placeholder instead, so that the value doesn't take down the program.
+func (h *Handler) recoverValue(buf *bytes.Buffer, start int, key string, indentLevel int, groups []string, align int) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	buf.Truncate(start)
+	h.appendKeyVal(buf, key, h.text(colourRed, formatPanic(p)), indentLevel, groups, align)
+}
@@ -0,0 +1,102 @@
+package devslog
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+)
+
+// A LevelRoute sends the records at or above a level to a writer other than
+// the handler's. See Options.LevelRoutes.
+type LevelRoute struct {
+	// Level is the minimum level of the records written to Writer.
+	Level slog.Level
+	// Writer is the destination of the records.
+	Writer io.Writer
+}
+
+// A GroupRoute sends the records of a subsystem, identified by the first group
+// opened with WithGroup, to a writer of its own. See Options.GroupRoutes.
+type GroupRoute struct {
+	// Group is the name of the root group of the subsystem's records.
+	Group string
+	// Writer is the destination of the subsystem's records.
+	Writer io.Writer
+	// Exclusive prevents the records from also being written to the
+	// handler's writer.
+	Exclusive bool
+}
+
+// destinations returns the writers of a record at level. The caller must hold
+// the mutex.
+func (h *Handler) destinations(level slog.Level) []io.Writer {
+	var root string
+	for _, goa := range h.goas {
+		if goa.group != "" {
+			root = goa.group
+			break
+		}
+	}
+
+	var out []io.Writer
+	exclusive := false
+	for _, route := range h.opts.GroupRoutes {
+		if root != "" && route.Group == root {
+			out = append(out, route.Writer)
+			exclusive = exclusive || route.Exclusive
+		}
+	}
+	if !exclusive {
+		out = append([]io.Writer{h.writerFor(level)}, out...)
+	}
+	return out
+}
+
+// writerFor returns the writer of the records at level. It's the writer of the
+// route with the highest Level that is at most level, or the handler's writer
+// if there is no such route. The caller must hold the mutex.
+func (h *Handler) writerFor(level slog.Level) io.Writer {
+	w := h.state.w
+	var found bool
+	var best slog.Level
+	for _, route := range h.opts.LevelRoutes {
+		if route.Level <= level && (!found || route.Level >= best) {
+			w, best, found = route.Writer, route.Level, true
+		}
+	}
+	return w
+}
+
+// writers returns each distinct writer that the handler may write to. The
+// caller must hold the mutex.
+func (h *Handler) writers() []io.Writer {
+	out := []io.Writer{h.state.w}
+	for _, route := range h.opts.LevelRoutes {
+		if !containsWriter(out, route.Writer) {
+			out = append(out, route.Writer)
+		}
+	}
+	for _, route := range h.opts.GroupRoutes {
+		if !containsWriter(out, route.Writer) {
+			out = append(out, route.Writer)
+		}
+	}
+	return out
+}
+
+func containsWriter(ws []io.Writer, w io.Writer) bool {
+	for _, x := range ws {
+		if sameWriter(x, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameWriter reports whether a and b are the same writer. Writers of types
+// that can't be compared, such as funcs or slices, are never the same, rather
+// than panicking.
+func sameWriter(a, b io.Writer) bool {
+	ta := reflect.TypeOf(a)
+	return ta == reflect.TypeOf(b) && ta != nil && ta.Comparable() && a == b
+}
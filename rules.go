@@ -0,0 +1,67 @@
+package devslog
+
+import (
+	"bytes"
+	"log/slog"
+)
+
+// A StyleRule applies a style to a whole record when one of its attributes is
+// a boolean with a particular value. For example, this dims cache hits:
+//
+//	devslog.StyleRule{Key: "cached", Value: true, Style: devslog.Dim}
+//
+// Only the attributes added with WithAttrs or to the record itself are
+// considered; the attributes of group values are not.
+type StyleRule struct {
+	// Key is the key of the boolean attribute.
+	Key string
+	// Value is the value of the attribute that triggers the rule.
+	Value bool
+	// Style is applied to every line of the record.
+	Style Color
+}
+
+// recordStyle returns the escape sequence of the first StyleRule matching r, or
+// an empty string if none does.
+func (h *Handler) recordStyle(r slog.Record) string {
+	if len(h.opts.StyleRules) == 0 || h.depth == ColorDepthNone {
+		return ""
+	}
+
+	var style string
+	match := func(a slog.Attr) bool {
+		v := resolve(a.Value)
+		if v.Kind() != slog.KindBool {
+			return true
+		}
+		for _, rule := range h.opts.StyleRules {
+			if rule.Key == a.Key && rule.Value == v.Bool() {
+				style = rule.Style.seq(h.depth)
+				return false
+			}
+		}
+		return true
+	}
+	for _, goa := range h.goas {
+		for _, a := range goa.attrs {
+			if !match(a) {
+				return style
+			}
+		}
+	}
+	r.Attrs(match)
+	return style
+}
+
+// applyStyle applies style to each line of record. The style is restored after
+// each reset sequence, so that it also covers the colored parts of a line.
+func applyStyle(record []byte, style string) []byte {
+	var out bytes.Buffer
+	for line := range bytes.Lines(record) {
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		_, _ = out.WriteString(style)
+		_, _ = out.Write(bytes.ReplaceAll(line, []byte(resetColour), []byte(resetColour+style)))
+		_, _ = out.WriteString(resetColour + "\n")
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,83 @@
+package devslog
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultSidebarWidth is the number of columns reserved for the sidebar when
+// Options.SidebarWidth is not set.
+const defaultSidebarWidth = 32
+
+// sidebarActive reports whether the attributes named by SidebarKeys are shown
+// in the sidebar instead of with the other attributes. The sidebar needs to
+// know the width of the output, so it's inactive when that is unknown.
+func (h *Handler) sidebarActive() bool {
+	return len(h.opts.SidebarKeys) > 0 && h.width() > 0
+}
+
+// inSidebar reports whether a is rendered in the sidebar. Only top-level
+// attributes are, so that attributes in groups keep their group.
+func (h *Handler) inSidebar(a slog.Attr, topLevel bool) bool {
+	return topLevel && h.sidebarActive() && slices.Contains(h.opts.SidebarKeys, a.Key)
+}
+
+// sidebar returns the text of the sidebar for r. It consists of the values of
+// the top-level attributes named by SidebarKeys, in that order. Group
+// attributes are not searched.
+func (h *Handler) sidebar(r slog.Record) string {
+	if !h.sidebarActive() {
+		return ""
+	}
+
+	values := make(map[string]string, len(h.opts.SidebarKeys))
+	topLevel := true
+	collect := func(a slog.Attr) bool {
+		switch {
+		case !h.inSidebar(a, topLevel):
+		case h.isRedacted(a.Key):
+			values[a.Key] = h.redact(valueString(resolve(a.Value)))
+		default:
+			values[a.Key] = h.mask(valueString(resolve(a.Value)))
+		}
+		return true
+	}
+	for _, goa := range h.goas {
+		if goa.group != "" {
+			topLevel = false
+		}
+		for _, a := range goa.attrs {
+			collect(a)
+		}
+	}
+	r.Attrs(collect)
+
+	parts := make([]string, 0, len(values))
+	for _, key := range h.opts.SidebarKeys {
+		if val, ok := values[key]; ok {
+			parts = append(parts, key+"="+val)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// appendSidebar pads the line starting at lineStart in buf so that the sidebar
+// is right-aligned to the width of the output.
+func (h *Handler) appendSidebar(buf *bytes.Buffer, lineStart int, sidebar string) {
+	width := h.opts.SidebarWidth
+	if width <= 0 {
+		width = defaultSidebarWidth
+	}
+
+	if utf8.RuneCountInString(sidebar) > width {
+		runes := []rune(sidebar)
+		sidebar = string(runes[:width-1]) + "…"
+	}
+
+	lineWidth := utf8.RuneCountInString(stripANSI(buf.String()[lineStart:]))
+	padding := max(h.width()-width-lineWidth, 1) + width - utf8.RuneCountInString(sidebar)
+	_, _ = buf.WriteString(strings.Repeat(" ", padding) + h.gray(sidebar))
+}
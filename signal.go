@@ -0,0 +1,41 @@
+//go:build unix
+
+package devslog
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// HandleLevelSignals makes the handler more verbose when the process receives
+// SIGUSR1, and less verbose when it receives SIGUSR2, one level at a time, as
+// in "kill -USR1 <pid>", so that a long-running program can show its debug
+// records without being restarted. Each change is logged at the new level.
+// Like [Handler.SetLevel], it has no effect when the Level option is a
+// [slog.Leveler] other than a [*slog.LevelVar]. The returned function stops
+// handling the signals.
+func (h *Handler) HandleLevelSignals() (stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-c:
+				h.stepLevel(sig == syscall.SIGUSR1)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
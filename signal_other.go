@@ -0,0 +1,9 @@
+//go:build !unix
+
+package devslog
+
+// HandleLevelSignals does nothing, because SIGUSR1 and SIGUSR2 don't exist on
+// this platform. See the documentation on other platforms for details.
+func (h *Handler) HandleLevelSignals() (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package devslog
+
+import (
+	"io"
+	"log/slog"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleLevelSignals(t *testing.T) {
+	h := New(io.Discard, nil)
+	stop := h.HandleLevelSignals()
+	defer stop()
+
+	for _, tc := range []struct {
+		sig  syscall.Signal
+		want slog.Level
+	}{
+		{sig: syscall.SIGUSR1, want: slog.LevelDebug},
+		{sig: syscall.SIGUSR2, want: slog.LevelInfo},
+		{sig: syscall.SIGUSR2, want: slog.LevelWarn},
+	} {
+		if err := syscall.Kill(syscall.Getpid(), tc.sig); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for h.Level() != tc.want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if got := h.Level(); got != tc.want {
+			t.Fatalf("%v: got %v, want %v", tc.sig, got, tc.want)
+		}
+	}
+
+	stop()
+	stop()
+}
@@ -0,0 +1,40 @@
+package devslog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// byteSizeUnits are the binary units of the ByteSizeKeys option.
+var byteSizeUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// isByteSize reports whether key matches one of the ByteSizeKeys option.
+func (h *Handler) isByteSize(key string) bool {
+	return matchAny(h.opts.ByteSizeKeys, key)
+}
+
+// formatByteSize renders a size of n bytes in the largest binary unit that
+// keeps it at 1 or more, with a decimal, as in "1.4 MiB (1468006)". Sizes
+// under 1 KiB are rendered in bytes, as in "512 B".
+func (h *Handler) formatByteSize(negative bool, n uint64) string {
+	raw := h.groupThousands(strconv.FormatUint(n, 10))
+	sign := ""
+	if negative {
+		raw, sign = "-"+raw, "-"
+	}
+	if n < 1024 {
+		return raw + " B"
+	}
+
+	size, unit := float64(n)/1024, 0
+	for size >= 1024 && unit < len(byteSizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+	s := strings.TrimSuffix(strconv.FormatFloat(size, 'f', 1, 64), ".0")
+	// Rounding may carry the size over to the next unit.
+	if s == "1024" && unit < len(byteSizeUnits)-1 {
+		s, unit = "1", unit+1
+	}
+	return sign + s + " " + byteSizeUnits[unit] + " (" + raw + ")"
+}
@@ -0,0 +1,60 @@
+package devslog
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// source returns the location of the call that created r, or nil if it's
+// unknown.
+func source(r slog.Record) *slog.Source {
+	if r.PC == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames([]uintptr{r.PC})
+	f, _ := frames.Next()
+	if f.File == "" {
+		return nil
+	}
+	return &slog.Source{Function: f.Function, File: f.File, Line: f.Line}
+}
+
+// sourceText renders src for the first line of a record as a dimmed
+// "dir/file.go:123", preceded by the function, as in "main.run@", when the
+// SourceFunc option is set. When the SourceLinks option is set and the output
+// supports it, the text is also a hyperlink to the file.
+func (h *Handler) sourceText(src *slog.Source) string {
+	dir, file := filepath.Split(src.File)
+	loc := filepath.Join(filepath.Base(dir), file) + ":" + strconv.Itoa(src.Line)
+	if h.opts.SourceFunc && src.Function != "" {
+		loc = funcName(src.Function) + "@" + loc
+	}
+	loc = h.text(h.sourceColour(), loc)
+
+	if !h.opts.SourceLinks || !h.hyperlinks {
+		return loc
+	}
+	return hyperlink(h.sourceURL(src), loc)
+}
+
+// sourceURL returns the URL of the SourceLinks hyperlink to src.
+func (h *Handler) sourceURL(src *slog.Source) string {
+	path := src.File
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if h.opts.SourceURLTemplate == "" {
+		return "file://" + filepath.ToSlash(path)
+	}
+	return fmt.Sprintf(h.opts.SourceURLTemplate, path, src.Line)
+}
+
+// funcName returns the name of function without the path of its package, as
+// in "devslog.(*Handler).Handle".
+func funcName(function string) string {
+	return function[strings.LastIndexByte(function, '/')+1:]
+}
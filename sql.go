@@ -0,0 +1,205 @@
+package devslog
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// sqlClauses are the keywords that start a line when a query is reflowed.
+var sqlClauses = []string{
+	"SELECT", "FROM", "WHERE", "GROUP", "ORDER", "HAVING", "LIMIT", "OFFSET",
+	"JOIN", "LEFT", "RIGHT", "INNER", "FULL", "CROSS", "NATURAL", "UNION",
+	"INSERT", "VALUES", "UPDATE", "SET", "DELETE", "RETURNING", "WITH",
+}
+
+// sqlJoinModifiers are the keywords that continue a clause started by the
+// previous one, as in "LEFT OUTER JOIN".
+var sqlJoinModifiers = []string{"LEFT", "RIGHT", "INNER", "OUTER", "FULL", "CROSS", "NATURAL"}
+
+// sqlKeywords are highlighted, in addition to sqlClauses.
+var sqlKeywords = []string{
+	"ALL", "AND", "ANY", "AS", "ASC", "BETWEEN", "BY", "CASE", "CONFLICT",
+	"DESC", "DISTINCT", "DO", "ELSE", "END", "EXISTS", "FALSE", "IN", "INTO",
+	"IS", "LIKE", "ILIKE", "NOT", "NOTHING", "NULL", "ON", "OR", "OUTER",
+	"THEN", "TRUE", "USING", "WHEN",
+}
+
+// colourSQLKeyword is the color of SQL keywords.
+var colourSQLKeyword = Blue
+
+// sqlTokenKind is the kind of a token of SQL.
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlString
+	sqlNumber
+	sqlComment
+	sqlSpace
+	sqlOther
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// isSQL reports whether the value of the attribute key is rendered as SQL, by
+// the SQLKeys option.
+func (h *Handler) isSQL(key string, v slog.Value) bool {
+	return v.Kind() == slog.KindString && slices.Contains(h.opts.SQLKeys, key) &&
+		(h.opts.MaxValueLen <= 0 || utf8.RuneCountInString(v.String()) <= h.opts.MaxValueLen)
+}
+
+// appendSQL writes an attribute whose value is the query s, with a line for
+// each clause and its keywords highlighted. Queries of a single clause stay
+// on the line of the key.
+func (h *Handler) appendSQL(buf *bytes.Buffer, key, s string, indentLevel int, groups []string, align int) {
+	lines := h.reflowSQL(s)
+	if len(lines) == 1 {
+		h.appendKeyVal(buf, key, lines[0], indentLevel, groups, align)
+		return
+	}
+	h.appendKeyVal(buf, key, h.gray("|"), indentLevel, groups, align)
+	h.appendBlock(buf, lines, indentLevel)
+}
+
+// reflowSQL breaks s into lines before its clauses, and before the AND and OR
+// operators of its outermost conditions, which are indented. Subqueries are
+// kept on the line of their clause. Runs of spaces are collapsed, outside of
+// strings and comments.
+func (h *Handler) reflowSQL(s string) []string {
+	var lines []string
+	var line strings.Builder
+	newLine := func(indent string) {
+		if line.Len() > 0 {
+			lines = append(lines, strings.TrimRight(line.String(), " "))
+			line.Reset()
+		}
+		line.WriteString(indent)
+	}
+
+	var depth int
+	var prev string
+	for _, tok := range tokenizeSQL(s) {
+		switch tok.kind {
+		case sqlSpace:
+			if line.Len() > 0 && !strings.HasSuffix(line.String(), " ") {
+				line.WriteByte(' ')
+			}
+			continue
+		case sqlWord:
+			upper := strings.ToUpper(tok.text)
+			continues := slices.Contains(sqlJoinModifiers, prev) && (upper == "JOIN" || upper == "OUTER")
+			continues = continues || (prev == "UNION" && upper == "ALL")
+			switch {
+			case depth > 0:
+			case slices.Contains(sqlClauses, upper) && !continues:
+				newLine("")
+			case upper == "AND" || upper == "OR":
+				newLine("  ")
+			}
+			if slices.Contains(sqlClauses, upper) || slices.Contains(sqlKeywords, upper) {
+				line.WriteString(h.text(colourSQLKeyword, tok.text))
+			} else {
+				line.WriteString(tok.text)
+			}
+			prev = upper
+			continue
+		case sqlString:
+			line.WriteString(h.text(h.kindColor(slog.KindString), tok.text))
+		case sqlNumber:
+			line.WriteString(h.text(h.kindColor(slog.KindInt64), tok.text))
+		case sqlComment:
+			line.WriteString(h.gray(tok.text))
+			// The comment ends at the end of the line.
+			newLine("")
+		default:
+			switch tok.text {
+			case "(":
+				depth++
+			case ")":
+				depth = max(depth-1, 0)
+			}
+			line.WriteString(tok.text)
+		}
+		prev = ""
+	}
+	newLine("")
+	if len(lines) == 0 {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// tokenizeSQL splits s into the tokens that reflowSQL needs. It's not a full
+// lexer: it only knows enough to not mistake the content of strings, quoted
+// identifiers and comments for keywords.
+func tokenizeSQL(s string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		start := i
+		var kind sqlTokenKind
+		switch {
+		case unicode.IsSpace(r):
+			kind = sqlSpace
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += size
+			}
+		case r == '\'' || r == '"' || r == '`':
+			kind = sqlString
+			if r != '\'' {
+				// A quoted identifier.
+				kind = sqlOther
+			}
+			i++
+			for i < len(s) {
+				if s[i] == byte(r) {
+					i++
+					// Quotes are escaped by doubling them.
+					if i < len(s) && s[i] == byte(r) {
+						i++
+						continue
+					}
+					break
+				}
+				i++
+			}
+		case strings.HasPrefix(s[i:], "--"):
+			kind = sqlComment
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s) - i
+			}
+			i += end
+		case unicode.IsDigit(r):
+			kind = sqlNumber
+			for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+				i++
+			}
+		case unicode.IsLetter(r) || r == '_':
+			kind = sqlWord
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' {
+					break
+				}
+				i += size
+			}
+		default:
+			kind = sqlOther
+			i += size
+		}
+		tokens = append(tokens, sqlToken{kind: kind, text: s[start:i]})
+	}
+	return tokens
+}
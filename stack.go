@@ -0,0 +1,135 @@
+package devslog
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// maxStackFrames is the number of frames of a stack trace that are shown.
+const maxStackFrames = 32
+
+// stackKey is the key of the stack trace of the StackTraceLevel option.
+const stackKey = "stack"
+
+// stackTrace returns the stack of the goroutine that logs r, starting at the
+// call that created r, if the level of r is at least the StackTraceLevel
+// option. Otherwise, it returns nil.
+func (h *Handler) stackTrace(r slog.Record) []runtime.Frame {
+	if h.opts.StackTraceLevel == nil || r.Level < h.opts.StackTraceLevel.Level() {
+		return nil
+	}
+	pcs := make([]uintptr, 64)
+	frames := collectFrames(runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)]))
+	if src := source(r); src != nil {
+		for i, f := range frames {
+			if f.Function == src.Function && f.File == src.File && f.Line == src.Line {
+				return frames[i:]
+			}
+		}
+	}
+	// Without the location of the call, drop the frames of the handler and
+	// of the slog package that called it.
+	for i := len(frames) - 1; i >= 0; i-- {
+		if strings.HasPrefix(frames[i].Function, "log/slog.") {
+			return frames[i+1:]
+		}
+	}
+	return frames
+}
+
+// stackFrames returns the frames of the stack trace carried by x: a
+// [runtime.Frames], a []runtime.Frame, or a value with a StackTrace method
+// that returns program counters, like the errors of github.com/pkg/errors.
+// For an error, it's the stack trace of the innermost error of its chain that
+// has one, which is the closest to where the error originated.
+func stackFrames(x any) ([]runtime.Frame, bool) {
+	if err, ok := x.(error); ok {
+		var frames []runtime.Frame
+		var found bool
+		for i := 0; err != nil && i < maxErrorCauses; i++ {
+			if f, ok := ownStackFrames(err); ok {
+				frames, found = f, true
+			}
+			err = errors.Unwrap(err)
+		}
+		return frames, found
+	}
+	return ownStackFrames(x)
+}
+
+// ownStackFrames is like stackFrames, without looking into the errors that x
+// wraps.
+func ownStackFrames(x any) ([]runtime.Frame, bool) {
+	switch x := x.(type) {
+	case nil:
+		return nil, false
+	case []runtime.Frame:
+		return x, true
+	case *runtime.Frames:
+		if x == nil {
+			return nil, false
+		}
+		return collectFrames(x), true
+	}
+
+	m := reflect.ValueOf(x).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil, false
+	}
+	if t := m.Type().Out(0); t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Uintptr {
+		return nil, false
+	}
+	trace := m.Call(nil)[0]
+	pcs := make([]uintptr, trace.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(trace.Index(i).Uint())
+	}
+	if len(pcs) == 0 {
+		return nil, false
+	}
+	return collectFrames(runtime.CallersFrames(pcs)), true
+}
+
+// collectFrames returns the remaining frames of frames.
+func collectFrames(frames *runtime.Frames) []runtime.Frame {
+	var collected []runtime.Frame
+	for {
+		f, more := frames.Next()
+		if f.Function != "" || f.File != "" {
+			collected = append(collected, f)
+		}
+		if !more {
+			return collected
+		}
+	}
+}
+
+// appendStack writes an attribute whose value is a stack trace, with the
+// number of its frames, followed by the frames on continuation lines.
+func (h *Handler) appendStack(buf *bytes.Buffer, key string, frames []runtime.Frame, indentLevel int, groups []string, align int) {
+	h.appendKeyVal(buf, key, h.gray("("+strconv.Itoa(len(frames))+" frames)"), indentLevel, groups, align)
+	h.appendBlock(buf, h.stackLines(frames), indentLevel)
+}
+
+// stackLines renders frames as dimmed lines, as in
+// "at main.run (app/main.go:42)", followed by the number of the frames beyond
+// maxStackFrames.
+func (h *Handler) stackLines(frames []runtime.Frame) []string {
+	var lines []string
+	for i, f := range frames {
+		if i == maxStackFrames {
+			lines = append(lines, h.text(Dim, "… ("+strconv.Itoa(len(frames)-i)+" more frames)"))
+			break
+		}
+		dir, file := filepath.Split(f.File)
+		loc := filepath.Join(filepath.Base(dir), file) + ":" + strconv.Itoa(f.Line)
+		lines = append(lines, h.text(Dim, "at "+funcName(f.Function)+" ("+loc+")"))
+	}
+	return lines
+}
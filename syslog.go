@@ -0,0 +1,63 @@
+//go:build unix
+
+package devslog
+
+import (
+	"log/slog"
+	"log/syslog"
+)
+
+// NewSyslogHandler creates a handler that formats records the same way as
+// [NewHandler], but sends each one to the local syslog daemon. The record level
+// is mapped to a syslog severity: DEBUG to LOG_DEBUG, INFO to LOG_INFO, WARN to
+// LOG_WARNING and ERROR to LOG_ERR. Levels in between are rounded down. The
+// messages have no colors, since the writer of the daemon isn't a terminal.
+//
+// On platforms without syslog support, NewSyslogHandler returns an error.
+func NewSyslogHandler(tag string, opts *slog.HandlerOptions) (*Handler, error) {
+	w, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return NewHandler(&syslogWriter{w: w}, opts), nil
+}
+
+// syslogger is the subset of the *syslog.Writer methods used to emit a message
+// at a particular severity.
+type syslogger interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+}
+
+// syslogWriter adapts a syslogger to the levelWriter interface so that the
+// handler can pick the severity of each record.
+type syslogWriter struct {
+	w syslogger
+}
+
+// Write sends p at the INFO severity. It's only used when the level of the
+// output is unknown.
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(slog.LevelInfo, p)
+}
+
+func (s *syslogWriter) WriteLevel(level slog.Level, p []byte) (int, error) {
+	msg := string(p)
+	var err error
+	switch {
+	case level >= slog.LevelError:
+		err = s.w.Err(msg)
+	case level >= slog.LevelWarn:
+		err = s.w.Warning(msg)
+	case level >= slog.LevelInfo:
+		err = s.w.Info(msg)
+	default:
+		err = s.w.Debug(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
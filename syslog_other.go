@@ -0,0 +1,14 @@
+//go:build !unix
+
+package devslog
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// NewSyslogHandler returns an error, because syslog is not available on this
+// platform. See the documentation on other platforms for details.
+func NewSyslogHandler(tag string, opts *slog.HandlerOptions) (*Handler, error) {
+	return nil, errors.New("devslog: syslog is not supported on this platform")
+}
@@ -0,0 +1,62 @@
+//go:build unix
+
+package devslog
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSyslogger records the severity and message of each call.
+type fakeSyslogger struct {
+	calls []string
+}
+
+func (f *fakeSyslogger) Debug(m string) error   { return f.record("debug", m) }
+func (f *fakeSyslogger) Info(m string) error    { return f.record("info", m) }
+func (f *fakeSyslogger) Warning(m string) error { return f.record("warning", m) }
+func (f *fakeSyslogger) Err(m string) error     { return f.record("err", m) }
+
+func (f *fakeSyslogger) record(severity, m string) error {
+	f.calls = append(f.calls, severity+" "+m)
+	return nil
+}
+
+func TestSyslogWriter(t *testing.T) {
+	now := time.Date(2009, time.November, 9, 23, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		level slog.Level
+		want  string
+	}{
+		{level: slog.LevelDebug - 4, want: "debug 23:00:00 TRACE msg\n"},
+		{level: slog.LevelDebug, want: "debug 23:00:00 DEBUG msg\n"},
+		{level: slog.LevelInfo, want: "info 23:00:00 INFO msg\n"},
+		{level: slog.LevelWarn + 1, want: "warning 23:00:00 WARN+1 msg\n"},
+		{level: slog.LevelError, want: "err 23:00:00 ERROR msg\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.level.String(), func(t *testing.T) {
+			fake := &fakeSyslogger{}
+			h := NewHandler(&syslogWriter{w: fake}, &slog.HandlerOptions{Level: slog.LevelDebug - 4})
+
+			err := h.Handle(t.Context(), slog.NewRecord(now, tc.level, "msg", 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(fake.calls) != 1 {
+				t.Fatalf("wrong number of calls; got %d, want 1", len(fake.calls))
+			}
+			if got := fake.calls[0]; got != tc.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tc.want)
+			}
+			if strings.Contains(fake.calls[0], "\033") {
+				t.Errorf("expected no colors, got %q", fake.calls[0])
+			}
+		})
+	}
+}
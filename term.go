@@ -0,0 +1,67 @@
+package devslog
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// fder is implemented by writers backed by a file descriptor, such as
+// [os.File].
+type fder interface {
+	Fd() uintptr
+}
+
+// terminalWidth returns the number of columns of the terminal that w writes
+// to. The COLUMNS environment variable takes precedence over asking the
+// terminal. It returns 0 when the width can't be determined.
+func terminalWidth(w io.Writer) int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	if f, ok := w.(fder); ok {
+		return fdWidth(f.Fd())
+	}
+	return 0
+}
+
+// resizable returns w if the width that terminalWidth returns for it comes
+// from a terminal, which may be resized later, or nil otherwise.
+func resizable(w io.Writer) fder {
+	if os.Getenv("COLUMNS") != "" {
+		return nil
+	}
+	if f, ok := w.(fder); ok && fdWidth(f.Fd()) > 0 {
+		return f
+	}
+	return nil
+}
+
+// width returns the number of columns of the output, or 0 if it's unknown.
+func (h *Handler) width() int {
+	return int(h.state.width.Load())
+}
+
+// refreshWidth asks the terminal of the output for its width again, so that
+// the output follows when the terminal is resized.
+func (h *Handler) refreshWidth() {
+	if h.tty == nil {
+		return
+	}
+	if n := fdWidth(h.tty.Fd()); n > 0 {
+		h.state.width.Store(int64(n))
+	}
+}
+
+// isTerminal reports whether w writes to a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
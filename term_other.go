@@ -0,0 +1,7 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package devslog
+
+// fdWidth always returns 0, because querying the terminal size isn't supported
+// on this platform.
+func fdWidth(fd uintptr) int { return 0 }
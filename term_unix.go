@@ -0,0 +1,21 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package devslog
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// fdWidth asks the terminal behind fd for its number of columns. It returns 0
+// if fd isn't a terminal.
+func fdWidth(fd uintptr) int {
+	var ws struct {
+		row, col, xpixel, ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.col)
+}
@@ -0,0 +1,94 @@
+package devslog
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// A Theme sets the colors of the elements of the output, to match the color
+// scheme of a terminal or a team's palette. Elements whose color is empty keep
+// their default color. See Options.Theme.
+type Theme struct {
+	// Levels maps levels to the colors of their names. The LevelColors
+	// option takes precedence.
+	Levels map[slog.Level]Color
+	// Key is the color of the keys of attributes. The default is Muted.
+	Key Color
+	// Group is the color of the names of groups. The default is Muted.
+	Group Color
+	// Time is the color of the time on the first line of a record. It's not
+	// colored by default.
+	Time Color
+	// Message is the color of messages. It's not colored by default. The
+	// ColorMessage option takes precedence.
+	Message Color
+	// Source is the color of the source location. The default is Muted.
+	Source Color
+	// Muted is the color of secondary text, such as badges, separators and
+	// the legend, and the default color of keys, groups and the source
+	// location. The default is gray.
+	Muted Color
+}
+
+// The built-in themes. When Options.Theme is not set, ThemeLight is used if
+// the COLORFGBG environment variable reports a light background, and
+// ThemeDark otherwise.
+var (
+	// ThemeDark is for terminals with a dark background.
+	ThemeDark = Theme{
+		Levels: map[slog.Level]Color{
+			slog.LevelInfo:  colourWhite,
+			slog.LevelWarn:  colourYellow,
+			slog.LevelError: colourRed,
+		},
+		Muted: colorGray,
+	}
+
+	// ThemeLight is for terminals with a light background, on which gray
+	// and yellow text is hard to read.
+	ThemeLight = Theme{
+		Levels: map[slog.Level]Color{
+			slog.LevelInfo:  Adaptive(Color256(235), Black),
+			slog.LevelWarn:  Adaptive(RGB(175, 95, 0), Color256(130), Yellow),
+			slog.LevelError: Adaptive(RGB(215, 0, 0), Color256(160), Red),
+		},
+		Muted: Adaptive(RGB(98, 98, 98), Color256(241), Black),
+	}
+)
+
+// sourceColour returns the color of the source location.
+func (h *Handler) sourceColour() Color {
+	return themeColor(h.opts.Theme.Source, themeColor(h.opts.Theme.Muted, colorGray))
+}
+
+// isZero reports whether t sets no color.
+func (t Theme) isZero() bool {
+	return t.Levels == nil && t.Key == "" && t.Group == "" && t.Time == "" &&
+		t.Message == "" && t.Source == "" && t.Muted == ""
+}
+
+// defaultTheme returns the theme that suits the background of the terminal.
+func defaultTheme() Theme {
+	if lightBackground() {
+		return ThemeLight
+	}
+	return ThemeDark
+}
+
+// lightBackground reports whether the COLORFGBG environment variable, set by
+// some terminals as "foreground;background", reports a light background:
+// white or bright white.
+func lightBackground() bool {
+	fgbg := os.Getenv("COLORFGBG")
+	bg := fgbg[strings.LastIndexByte(fgbg, ';')+1:]
+	return fgbg != "" && (bg == "7" || bg == "15")
+}
+
+// themeColor returns c, or def if c is empty.
+func themeColor(c, def Color) Color {
+	if c == "" {
+		return def
+	}
+	return c
+}
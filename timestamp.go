@@ -0,0 +1,155 @@
+package devslog
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// dateTimeLayout is the layout of times when the ShowDate option is set. It has
+// no spaces, so that the time remains a single field on the first line.
+const dateTimeLayout = time.DateOnly + "T" + time.TimeOnly
+
+// timeLayout returns the layout of times for opts.
+func timeLayout(opts Options) string {
+	if opts.TimeFormat != "" {
+		return opts.TimeFormat
+	}
+
+	layout := time.TimeOnly
+	if l, ok := lookupLocale(opts.TimeLocale); ok {
+		layout = l.time
+		if opts.ShowDate {
+			layout = l.date + "\u00a0" + l.time
+		}
+	} else if opts.ShowDate {
+		layout = dateTimeLayout
+	}
+	if n := min(opts.TimePrecision, 9); n > 0 {
+		layout = strings.Replace(layout, "05", "05."+strings.Repeat("0", n), 1)
+	}
+	return layout
+}
+
+// formatTime formats t in the layout of the built-in time attribute, which is
+// also used for time-valued attributes.
+func (h *Handler) formatTime(t time.Time) string {
+	if h.opts.TimeZone != nil {
+		t = t.In(h.opts.TimeZone)
+	}
+
+	var s string
+	if h.opts.TimeFormatter != nil {
+		s = h.opts.TimeFormatter(t)
+	} else {
+		s = t.Format(h.timeLayout)
+	}
+	if h.opts.ShowTimeZone {
+		// A non-breaking space keeps the time a single field.
+		zone, _ := t.Zone()
+		s += "\u00a0" + zone
+	}
+	return s
+}
+
+// timestamp formats t, the time of a record at level, for the first line of a
+// record. It returns an empty string when the time should be left out.
+func (h *Handler) timestamp(t time.Time, level slog.Level) string {
+	if !h.opts.TimeDelta {
+		return h.formatTime(t)
+	}
+
+	h.mu.Lock()
+	prev, abs := h.state.prevTime, h.state.absTime
+	h.state.prevTime = t
+	// There's nothing to compare the first record to, so show when it happened.
+	full := prev.IsZero() ||
+		(h.opts.TimeDeltaInterval > 0 && t.Sub(abs) >= h.opts.TimeDeltaInterval) ||
+		(h.opts.TimeDeltaLevel != nil && level >= h.opts.TimeDeltaLevel.Level())
+	if full {
+		h.state.absTime = t
+	}
+	h.mu.Unlock()
+
+	if full {
+		return h.formatTime(t)
+	}
+
+	d := t.Sub(prev)
+	if d < h.opts.TimeDeltaThreshold {
+		return ""
+	}
+	return h.withAbsoluteTime(t, formatDelta(d))
+}
+
+// withAbsoluteTime links a relative time, rel, to the absolute time t when the
+// TimeHover option is set and the output supports it.
+func (h *Handler) withAbsoluteTime(t time.Time, rel string) string {
+	if !h.opts.TimeHover || !h.hyperlinks {
+		return rel
+	}
+	return hyperlink("time:"+t.Format(time.RFC3339Nano), rel)
+}
+
+// dateBanner returns the line of the DateBanner option that goes before a
+// record at t, or an empty string if the day didn't change since the previous
+// record.
+func (h *Handler) dateBanner(t time.Time) string {
+	if !h.opts.DateBanner || t.IsZero() {
+		return ""
+	}
+	if h.opts.TimeZone != nil {
+		t = t.In(h.opts.TimeZone)
+	}
+	date := t.Format(time.DateOnly)
+
+	h.mu.Lock()
+	prev := h.state.prevDate
+	h.state.prevDate = date
+	h.mu.Unlock()
+
+	if prev == "" || prev == date {
+		return ""
+	}
+	return h.gray(h.rule(2)+" "+date+" "+h.rule(2)) + "\n"
+}
+
+// formatElapsed renders d, the time elapsed since the start of the handler,
+// with millisecond precision from a second, as in "T+1.234s" or "T+12.5ms".
+func formatElapsed(d time.Duration) string {
+	sign := "T+"
+	if d < 0 {
+		sign = "T-"
+		d = -d
+	}
+
+	switch {
+	case d < time.Microsecond:
+	case d < time.Second:
+		d = d.Round(time.Microsecond)
+	default:
+		d = d.Round(time.Millisecond)
+	}
+	return sign + d.String()
+}
+
+// formatDelta renders d with a leading sign, rounded to a precision that keeps
+// it short: "+850ns", "+12µs", "+250ms", "+1.2s".
+func formatDelta(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+
+	switch {
+	case d < time.Microsecond:
+	case d < time.Millisecond:
+		d = d.Round(time.Microsecond)
+	case d < time.Second:
+		d = d.Round(time.Millisecond)
+	default:
+		d = d.Round(100 * time.Millisecond)
+	}
+	return sign + d.String()
+}
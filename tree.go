@@ -0,0 +1,112 @@
+package devslog
+
+import (
+	"bytes"
+	"strings"
+)
+
+// The cells of the TreeConnectors layout, which are all three columns wide.
+const (
+	connectorPipe  = "│  "
+	connectorTee   = "├─ "
+	connectorElbow = "└─ "
+	connectorBlank = "   "
+)
+
+// connectors returns the pipe, tee and elbow cells, in ASCII with the ASCII
+// option.
+func (h *Handler) connectors() (pipe, tee, elbow string) {
+	if h.opts.ASCII {
+		return "|  ", "|- ", "`- "
+	}
+	return connectorPipe, connectorTee, connectorElbow
+}
+
+// rule returns a horizontal line of n cells, in ASCII with the ASCII option,
+// for the lines of the DateBanner option and of batches.
+func (h *Handler) rule(n int) string {
+	if h.opts.ASCII {
+		return strings.Repeat("-", n)
+	}
+	return strings.Repeat("─", n)
+}
+
+// treeLine is an attribute line, or a continuation line of a value, of the
+// TreeConnectors layout.
+type treeLine struct {
+	// depth is the number of cells before the connector of an attribute, or
+	// before the text of a continuation line.
+	depth int
+	// entry is true for the lines of attributes and groups.
+	entry bool
+	// last is true for an entry that is the last one of its group.
+	last bool
+	text string
+}
+
+// connect replaces the placeholder cells that appendIndent and appendKeyVal
+// write in the TreeConnectors layout with the connectors that match the shape
+// of the tree, now that it's known which attributes are the last ones of their
+// groups. b holds whole lines.
+func (h *Handler) connect(b []byte) []byte {
+	var lines []treeLine
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if line == "" {
+			continue
+		}
+		l := treeLine{text: strings.TrimPrefix(line, " ")}
+		for {
+			if rest, ok := strings.CutPrefix(l.text, connectorPipe); ok {
+				l.depth++
+				l.text = rest
+				continue
+			}
+			l.text, l.entry = strings.CutPrefix(l.text, connectorTee)
+			break
+		}
+		lines = append(lines, l)
+	}
+
+	for i := range lines {
+		if !lines[i].entry {
+			continue
+		}
+		lines[i].last = true
+		for _, next := range lines[i+1:] {
+			if next.entry && next.depth <= lines[i].depth {
+				lines[i].last = next.depth < lines[i].depth
+				break
+			}
+		}
+	}
+
+	pipe, tee, elbow := h.connectors()
+
+	var buf bytes.Buffer
+	var lastAt []bool
+	for _, l := range lines {
+		var prefix strings.Builder
+		for k := range l.depth {
+			if k < len(lastAt) && lastAt[k] {
+				prefix.WriteString(connectorBlank)
+			} else {
+				prefix.WriteString(pipe)
+			}
+		}
+		if l.entry {
+			for len(lastAt) < l.depth {
+				lastAt = append(lastAt, false)
+			}
+			lastAt = append(lastAt[:l.depth], l.last)
+			if l.last {
+				prefix.WriteString(elbow)
+			} else {
+				prefix.WriteString(tee)
+			}
+		}
+		_ = buf.WriteByte(' ')
+		h.appendGray(&buf, prefix.String())
+		_, _ = buf.WriteString(l.text)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,111 @@
+package devslog
+
+import (
+	"log/slog"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A TruncateMode determines which part of a value longer than the MaxValueLen
+// option is cut.
+type TruncateMode int
+
+const (
+	// TruncateTail keeps the start of the value: "abcd…".
+	TruncateTail TruncateMode = iota
+	// TruncateHead keeps the end of the value: "…wxyz".
+	TruncateHead
+	// TruncateMiddle keeps the start and end of the value: "ab…yz".
+	TruncateMiddle
+)
+
+// truncate shortens s to the MaxValueLen option, counted in runes, when it's
+// longer than that. An ellipsis marks where s was cut, and the truncated value
+// ends with the length of s in bytes, such as "abcd…(4096 bytes)".
+func (h *Handler) truncate(s string) string {
+	limit := h.opts.MaxValueLen
+	n := utf8.RuneCountInString(s)
+	if limit <= 0 || n <= limit {
+		return s
+	}
+
+	var out string
+	switch h.opts.TruncateMode {
+	case TruncateHead:
+		out = "…" + s[runeOffset(s, n-limit):]
+	case TruncateMiddle:
+		head, tail := (limit+1)/2, limit/2
+		out = s[:runeOffset(s, head)] + "…" + s[runeOffset(s, n-tail):]
+	default:
+		out = s[:runeOffset(s, limit)] + "…"
+	}
+	return out + "(" + strconv.Itoa(len(s)) + " bytes)"
+}
+
+// untruncated is a string that is displayed in full, regardless of the
+// MaxValueLen option.
+type untruncated string
+
+// Untruncated returns an attribute for a string value that is displayed in
+// full, even when it's longer than Options.MaxValueLen, for the values that
+// are worth the space on a given call. Other handlers see a string.
+func Untruncated(key, value string) slog.Attr {
+	return slog.Any(key, untruncated(value))
+}
+
+// runeOffset returns the byte offset of the rune at index i of s. This is how
+// values are cut without splitting a multi-byte sequence.
+func runeOffset(s string, i int) int {
+	var n int
+	for offset := range s {
+		if n == i {
+			return offset
+		}
+		n++
+	}
+	return len(s)
+}
+
+// maxDepthCount is how deep the groups beyond the MaxDepth option are counted,
+// since LogValuers can nest groups without end.
+const maxDepthCount = 100
+
+// beyondMaxDepth reports whether a, an attribute of the groups, is a group
+// that is nested deeper than the MaxDepth option.
+func (h *Handler) beyondMaxDepth(groups []string, a slog.Attr) bool {
+	return h.opts.MaxDepth > 0 && a.Key != "" && a.Value.Kind() == slog.KindGroup && len(groups) >= h.opts.MaxDepth
+}
+
+// depthSummary returns the value that replaces the attributes of a group that
+// is nested deeper than the MaxDepth option, such as "… (3 more levels)".
+func depthSummary(attrs []slog.Attr) string {
+	n := groupDepth(attrs, maxDepthCount)
+	switch {
+	case n == 1:
+		return "… (1 more level)"
+	case n > maxDepthCount:
+		return "… (over " + strconv.Itoa(maxDepthCount) + " more levels)"
+	default:
+		return "… (" + strconv.Itoa(n) + " more levels)"
+	}
+}
+
+// groupDepth returns the number of levels of the group with attrs, counting
+// the group itself. It stops counting after limit levels.
+func groupDepth(attrs []slog.Attr, limit int) int {
+	if limit == 0 {
+		return 1
+	}
+	var deepest int
+	for _, a := range attrs {
+		if v := resolve(a.Value); v.Kind() == slog.KindGroup {
+			n := groupDepth(v.Group(), limit-1)
+			if a.Key == "" {
+				// Inline groups are at the level of their parent.
+				n--
+			}
+			deepest = max(deepest, n)
+		}
+	}
+	return deepest + 1
+}
@@ -0,0 +1,119 @@
+package devslog
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// wrap breaks s into lines of at most first columns for the first line and
+// rest columns for the others. It breaks on spaces when possible and within
+// words that don't fit on a line of their own. Escape sequences don't count
+// towards the width of a line. Lines hold at least one column, however
+// little room the indentation leaves.
+func wrap(s string, first, rest int) []string {
+	rest = max(rest, 1)
+	var lines []string
+	width := first
+	if width < 1 {
+		lines = append(lines, "")
+		width = rest
+	}
+
+	var line strings.Builder
+	lineWidth, started := 0, false
+	for _, word := range strings.Split(s, " ") {
+		for {
+			wordWidth := visibleWidth(word)
+			sep := 0
+			if started {
+				sep = 1
+			}
+			if lineWidth+sep+wordWidth <= width {
+				if started {
+					line.WriteByte(' ')
+				}
+				line.WriteString(word)
+				lineWidth += sep + wordWidth
+				started = true
+				break
+			}
+			if started {
+				lines = append(lines, line.String())
+				line.Reset()
+				lineWidth, started, width = 0, false, rest
+				continue
+			}
+
+			// The word doesn't fit on a line of its own.
+			head, tail := splitWidth(word, width)
+			lines = append(lines, head)
+			word, width = tail, rest
+		}
+	}
+	return append(lines, line.String())
+}
+
+// visibleWidth returns the number of columns that s takes.
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(stripANSI(s))
+}
+
+// splitWidth splits s after n columns. Escape sequences are kept intact.
+func splitWidth(s string, n int) (string, string) {
+	for i := 0; i < len(s); {
+		if s[i] == '\033' && i+1 < len(s) {
+			i = escapeEnd(s, i) + 1
+			continue
+		}
+		if n == 0 {
+			return s[:i], s[i:]
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n--
+	}
+	return s, ""
+}
+
+// appendMultiline writes an attribute whose value, s, has several lines as a
+// block below its key, like a literal block of YAML, so that the lines don't
+// break the indentation of the output.
+func (h *Handler) appendMultiline(buf *bytes.Buffer, a slog.Attr, s string, indentLevel int, groups []string, align int) {
+	h.appendKeyValSeq(buf, h.attrKeySeq(a.Value), a.Key, h.gray("|"), indentLevel, groups, align)
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if h.opts.Wrap && h.width() > 0 {
+			width := h.width() - h.blockIndent(indentLevel)
+			for _, l := range wrap(line, width, width) {
+				lines = append(lines, h.valueText(a.Value, l))
+			}
+			continue
+		}
+		lines = append(lines, h.valueText(a.Value, line))
+	}
+	h.appendBlock(buf, lines, indentLevel)
+}
+
+// blockIndent returns the width of the indentation of the continuation lines
+// of the attributes at indentLevel, which appendBlock writes.
+func (h *Handler) blockIndent(indentLevel int) int {
+	if h.opts.TreeConnectors {
+		return (indentLevel+1)*visibleWidth(connectorPipe) + 1
+	}
+	return (indentLevel+1)*visibleWidth(h.opts.Indent) + 1
+}
+
+// appendWrapped writes val, wrapped at the width of the output, after the
+// start of an attribute line, which begins at lineStart in buf. Continuation
+// lines are indented like the lines of a block.
+func (h *Handler) appendWrapped(buf *bytes.Buffer, lineStart int, val string, indentLevel int) {
+	indent := h.blockIndent(indentLevel)
+	prefixWidth := visibleWidth(string(buf.Bytes()[lineStart:]))
+	width := h.width()
+	lines := wrap(val, width-prefixWidth, width-indent)
+	_, _ = buf.WriteString(lines[0] + "\n")
+	h.appendBlock(buf, lines[1:], indentLevel)
+}